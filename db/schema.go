@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"log"
+	"strings"
 )
 
 // InitializeSchema runs the SQL to set up all the necessary tables
@@ -16,7 +17,8 @@ func InitializeSchema(db *sql.DB) {
 		age INTEGER NOT NULL,
 		gender TEXT NOT NULL,
 		email TEXT NOT NULL UNIQUE,
-		password_hash TEXT NOT NULL
+		password_hash TEXT NOT NULL,
+		is_admin INTEGER NOT NULL DEFAULT 0
 	);`
 
 createSessionsTable := `
@@ -50,12 +52,115 @@ CREATE TABLE IF NOT EXISTS comments (
 	user_id TEXT NOT NULL,
 	nickname TEXT NOT NULL,
 	content TEXT NOT NULL,
+	likes INTEGER DEFAULT 0,
+	dislikes INTEGER DEFAULT 0,
 	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 	FOREIGN KEY(post_id) REFERENCES posts(id),
 	FOREIGN KEY(user_id) REFERENCES users(id)
 );`
 
 
+	createConversationsTable := `
+	CREATE TABLE IF NOT EXISTS conversations (
+		id TEXT PRIMARY KEY,
+		user_one_id TEXT NOT NULL,
+		user_two_id TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		last_message_at DATETIME,
+		UNIQUE(user_one_id, user_two_id),
+		FOREIGN KEY(user_one_id) REFERENCES users(id),
+		FOREIGN KEY(user_two_id) REFERENCES users(id)
+	);`
+
+	createMessagesTable := `
+	CREATE TABLE IF NOT EXISTS messages (
+		id TEXT PRIMARY KEY,
+		conversation_id TEXT NOT NULL,
+		sender_id TEXT NOT NULL,
+		content TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY(conversation_id) REFERENCES conversations(id),
+		FOREIGN KEY(sender_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_messages_conversation
+		ON messages(conversation_id, created_at, id);`
+
+	createConversationReadsTable := `
+	CREATE TABLE IF NOT EXISTS conversation_reads (
+		conversation_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		last_read_message_id TEXT,
+		last_read_at DATETIME,
+		PRIMARY KEY(conversation_id, user_id),
+		FOREIGN KEY(conversation_id) REFERENCES conversations(id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);`
+
+	createReactionsTable := `
+	CREATE TABLE IF NOT EXISTS reactions (
+		user_id TEXT NOT NULL,
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		reaction TEXT NOT NULL CHECK(reaction IN ('like', 'dislike')),
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY(user_id, target_type, target_id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_reactions_target
+		ON reactions(target_type, target_id);`
+
+	createCategoriesTable := `
+	CREATE TABLE IF NOT EXISTS categories (
+		slug TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		position INTEGER NOT NULL DEFAULT 0,
+		archived INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Default categories; INSERT OR IGNORE keeps admin edits across restarts
+	seedCategories := `
+	INSERT OR IGNORE INTO categories (slug, name, description, position) VALUES
+		('general', 'General', 'Anything that does not fit elsewhere', 0),
+		('golang', 'Golang', 'The Go programming language', 1),
+		('html', 'HTML', 'Markup and document structure', 2),
+		('javascript', 'JavaScript', 'JavaScript in the browser and beyond', 3),
+		('css', 'CSS', 'Styling and layout', 4);`
+
+	createPostCategoriesTable := `
+	CREATE TABLE IF NOT EXISTS post_categories (
+		post_id TEXT NOT NULL,
+		category_slug TEXT NOT NULL,
+		PRIMARY KEY(post_id, category_slug),
+		FOREIGN KEY(post_id) REFERENCES posts(id),
+		FOREIGN KEY(category_slug) REFERENCES categories(slug)
+	);
+	CREATE INDEX IF NOT EXISTS idx_post_categories_slug
+		ON post_categories(category_slug, post_id);`
+
+	// Prior versions of edited posts, newest edited_at last
+	createPostRevisionsTable := `
+	CREATE TABLE IF NOT EXISTS post_revisions (
+		id TEXT PRIMARY KEY,
+		post_id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		content TEXT NOT NULL,
+		editor_id TEXT NOT NULL,
+		edited_at DATETIME NOT NULL,
+		FOREIGN KEY(post_id) REFERENCES posts(id),
+		FOREIGN KEY(editor_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_post_revisions_post
+		ON post_revisions(post_id, edited_at);`
+
+	// Copy the single category of posts created before post_categories existed
+	backfillPostCategories := `
+	INSERT OR IGNORE INTO post_categories (post_id, category_slug)
+	SELECT p.id, p.category_id FROM posts p
+	WHERE p.category_id IS NOT NULL AND p.category_id != ''
+		AND NOT EXISTS (SELECT 1 FROM post_categories pc WHERE pc.post_id = p.id);`
+
 	_, err := db.Exec(createUsersTable)
 	if err != nil {
 		log.Fatalf("error creating users table: %v", err)
@@ -76,5 +181,193 @@ CREATE TABLE IF NOT EXISTS comments (
 		log.Fatalf("error creating comments table: %v", err)
 	}
 
+	_, err = db.Exec(createConversationsTable)
+	if err != nil {
+		log.Fatalf("error creating conversations table: %v", err)
+	}
+
+	_, err = db.Exec(createMessagesTable)
+	if err != nil {
+		log.Fatalf("error creating messages table: %v", err)
+	}
+
+	_, err = db.Exec(createConversationReadsTable)
+	if err != nil {
+		log.Fatalf("error creating conversation_reads table: %v", err)
+	}
+
+	_, err = db.Exec(createReactionsTable)
+	if err != nil {
+		log.Fatalf("error creating reactions table: %v", err)
+	}
+
+	_, err = db.Exec(createCategoriesTable)
+	if err != nil {
+		log.Fatalf("error creating categories table: %v", err)
+	}
+
+	_, err = db.Exec(seedCategories)
+	if err != nil {
+		log.Fatalf("error seeding categories: %v", err)
+	}
+
+	_, err = db.Exec(createPostCategoriesTable)
+	if err != nil {
+		log.Fatalf("error creating post_categories table: %v", err)
+	}
+
+	_, err = db.Exec(backfillPostCategories)
+	if err != nil {
+		log.Fatalf("error backfilling post categories: %v", err)
+	}
+
+	_, err = db.Exec(createPostRevisionsTable)
+	if err != nil {
+		log.Fatalf("error creating post_revisions table: %v", err)
+	}
+
+	// Columns added after the first release; CREATE TABLE IF NOT EXISTS
+	// leaves existing databases untouched, so add them explicitly
+	addColumnIfMissing(db, "comments", "likes", "INTEGER DEFAULT 0")
+	addColumnIfMissing(db, "comments", "dislikes", "INTEGER DEFAULT 0")
+	addColumnIfMissing(db, "users", "is_admin", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing(db, "sessions", "created_at", "DATETIME")
+	addColumnIfMissing(db, "sessions", "user_agent", "TEXT")
+	addColumnIfMissing(db, "sessions", "ip", "TEXT")
+	addColumnIfMissing(db, "sessions", "remember", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing(db, "sessions", "ends_at", "DATETIME")
+	addColumnIfMissing(db, "sessions", "rotated_at", "DATETIME")
+	addColumnIfMissing(db, "sessions", "is_admin", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing(db, "sessions", "replaced_by", "TEXT")
+	addColumnIfMissing(db, "sessions", "csrf_token", "TEXT")
+	addColumnIfMissing(db, "posts", "edited_at", "DATETIME")
+	addColumnIfMissing(db, "posts", "deleted_at", "DATETIME")
+	addColumnIfMissing(db, "comments", "edited_at", "DATETIME")
+	addColumnIfMissing(db, "comments", "deleted_at", "DATETIME")
+	addColumnIfMissing(db, "comments", "parent_comment_id", "TEXT REFERENCES comments(id)")
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_comments_thread
+		ON comments(post_id, parent_comment_id, created_at)`)
+	if err != nil {
+		log.Fatalf("error creating comments thread index: %v", err)
+	}
+
+	// For the reaper's sweep of expired sessions
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at)`)
+	if err != nil {
+		log.Fatalf("error creating sessions expiry index: %v", err)
+	}
+
+	createSearchIndex(db)
+
 	
 }
+
+// addColumnIfMissing adds a column to an existing table unless it is already there
+func addColumnIfMissing(db *sql.DB, table, column, definition string) {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		log.Fatalf("error reading %s columns: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Fatalf("error reading %s columns: %v", table, err)
+		}
+		if name == column {
+			return
+		}
+	}
+	rows.Close()
+
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	if err != nil {
+		log.Fatalf("error adding %s.%s column: %v", table, column, err)
+	}
+}
+
+// createSearchIndex sets up the FTS5 tables behind /api/search and the
+// triggers that keep them in step with posts and comments. FTS5 is only
+// compiled into go-sqlite3 with the sqlite_fts5 build tag; without it the
+// forum still runs and search reports itself unavailable.
+func createSearchIndex(db *sql.DB) {
+	createSearchTables := `
+	CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+		post_id UNINDEXED, title, content, tokenize = 'porter unicode61'
+	);
+	CREATE VIRTUAL TABLE IF NOT EXISTS comments_fts USING fts5(
+		comment_id UNINDEXED, content, tokenize = 'porter unicode61'
+	);`
+
+	_, err := db.Exec(createSearchTables)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			log.Printf("search disabled: SQLite was built without FTS5 (build with -tags sqlite_fts5)")
+			return
+		}
+		log.Fatalf("error creating search tables: %v", err)
+	}
+
+	createSearchTriggers := `
+	CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER INSERT ON posts BEGIN
+		INSERT INTO posts_fts (post_id, title, content) VALUES (new.id, new.title, new.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS posts_fts_update AFTER UPDATE OF title, content ON posts BEGIN
+		DELETE FROM posts_fts WHERE post_id = old.id;
+		INSERT INTO posts_fts (post_id, title, content) VALUES (new.id, new.title, new.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS posts_fts_delete AFTER DELETE ON posts BEGIN
+		DELETE FROM posts_fts WHERE post_id = old.id;
+	END;
+	CREATE TRIGGER IF NOT EXISTS comments_fts_insert AFTER INSERT ON comments BEGIN
+		INSERT INTO comments_fts (comment_id, content) VALUES (new.id, new.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS comments_fts_update AFTER UPDATE OF content ON comments BEGIN
+		DELETE FROM comments_fts WHERE comment_id = old.id;
+		INSERT INTO comments_fts (comment_id, content) VALUES (new.id, new.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS comments_fts_delete AFTER DELETE ON comments BEGIN
+		DELETE FROM comments_fts WHERE comment_id = old.id;
+	END;`
+
+	_, err = db.Exec(createSearchTriggers)
+	if err != nil {
+		log.Fatalf("error creating search triggers: %v", err)
+	}
+
+	// Index rows written before the search tables existed
+	backfillSearchIndex := `
+	INSERT INTO posts_fts (post_id, title, content)
+	SELECT p.id, p.title, p.content FROM posts p
+	WHERE p.id NOT IN (SELECT post_id FROM posts_fts);
+	INSERT INTO comments_fts (comment_id, content)
+	SELECT c.id, c.content FROM comments c
+	WHERE c.id NOT IN (SELECT comment_id FROM comments_fts);`
+
+	_, err = db.Exec(backfillSearchIndex)
+	if err != nil {
+		log.Fatalf("error backfilling search index: %v", err)
+	}
+}
+
+// GrantAdmin gives the admin role to the users with the given nicknames,
+// matched case-insensitively. Blank names are ignored and unknown ones
+// logged. Nobody loses the role here; existing sessions pick it up on their
+// next request.
+func GrantAdmin(db *sql.DB, nicknames []string) {
+	for _, nickname := range nicknames {
+		nickname = strings.TrimSpace(nickname)
+		if nickname == "" {
+			continue
+		}
+		result, err := db.Exec(`UPDATE users SET is_admin = 1 WHERE nickname = ? COLLATE NOCASE`, nickname)
+		if err != nil {
+			log.Fatalf("error granting admin role to %s: %v", nickname, err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			log.Printf("Cannot grant admin role: no user named %s", nickname)
+		}
+	}
+}
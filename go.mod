@@ -6,8 +6,7 @@ toolchain go1.23.8
 
 require (
 	github.com/gofrs/uuid v4.4.0+incompatible
+	github.com/gorilla/websocket v1.5.3
 	github.com/mattn/go-sqlite3 v1.14.27
 	golang.org/x/crypto v0.37.0
 )
-
-require github.com/gorilla/websocket v1.5.3 // indirect
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -9,11 +8,11 @@ import (
 )
 
 // CheckAuthHandler verifies if the user's session is valid
-func CheckAuthHandler(db *sql.DB) http.HandlerFunc {
+func CheckAuthHandler(sessions SessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Auth check request received")
 
-		session := GetSession(db, r)
+		session := GetSession(sessions, r)
 		w.Header().Set("Content-Type", "application/json")
 
 		if session == nil || session.ExpiresAt.Before(time.Now()) {
@@ -30,59 +29,46 @@ func CheckAuthHandler(db *sql.DB) http.HandlerFunc {
 			"authenticated": true,
 			"user_id":       session.UserID,
 			"nickname":      session.Nickname,
+			"is_admin":      session.IsAdmin,
 		})
 	}
 }
 
-// OnlineUsersHandler returns list of online users active in the last 5 minutes
-func OnlineUsersHandler(db *sql.DB) http.HandlerFunc {
+// OnlineUsersHandler returns a snapshot of users with an open WebSocket connection.
+// Changes after the snapshot are pushed as presence.online/presence.offline events.
+func OnlineUsersHandler(sessions SessionStore, hub *Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
-		fiveMinutesAgo := time.Now().Add(-5 * time.Minute)
-
-		rows, err := db.Query(`
-			SELECT DISTINCT s.nickname 
-			FROM sessions s
-			WHERE s.last_active > ?
-			ORDER BY s.last_active DESC
-		`, fiveMinutesAgo)
-		if err != nil {
-			log.Printf("Database error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		if session := GetSession(sessions, r); session == nil {
+			w.WriteHeader(http.StatusUnauthorized)
 			json.NewEncoder(w).Encode(map[string]string{
-				"error": "Database error",
+				"error": "Unauthorized",
 			})
 			return
 		}
-		defer rows.Close()
-
-		var users []string
-		for rows.Next() {
-			var nickname string
-			if err := rows.Scan(&nickname); err != nil {
-				log.Printf("Error scanning nickname: %v", err)
-				continue
-			}
-			users = append(users, nickname)
-		}
 
-		json.NewEncoder(w).Encode(users)
+		json.NewEncoder(w).Encode(hub.OnlineUsers())
 	}
 }
 
-// UpdateLastActive updates the session's last_active timestamp if valid
-func UpdateLastActive(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	session := GetSession(db, r)
-	if session != nil && session.ExpiresAt.After(time.Now()) {
-		if cookie, err := r.Cookie("session"); err == nil {
-			_, err = db.Exec(
-				"UPDATE sessions SET last_active = ? WHERE id = ?",
-				time.Now(), cookie.Value,
-			)
-			if err != nil {
-				log.Printf("Last active update error: %v", err)
-			}
+// UpdateLastActive records activity on the request's session, keeping it
+// from expiring while the user is active. When the store rotates the
+// session the cookie and WebSocket connections move to the new ID.
+func UpdateLastActive(sessions SessionStore, hub *Hub, w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return
+	}
+	sess, err := sessions.Touch(cookie.Value)
+	if err != nil {
+		if err != ErrSessionNotFound {
+			log.Printf("Last active update error: %v", err)
 		}
+		return
+	}
+	if sess.ID != cookie.Value {
+		setSessionCookie(w, sess)
+		hub.RebindSession(cookie.Value, sess.ID)
 	}
-}
\ No newline at end of file
+}
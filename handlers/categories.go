@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"real-time-forum/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var categorySlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,31}$`)
+
+type categoryRequest struct {
+	Slug        string  `json:"slug"`
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Position    *int    `json:"position"`
+	Archived    *bool   `json:"archived"`
+}
+
+// CategoriesHandler lists categories with post counts. Admins can also
+// create (POST), rename or reorder (PUT ?slug=) and archive (DELETE ?slug=).
+func CategoriesHandler(db *sql.DB, sessions SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := GetSession(sessions, r)
+		if session == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			handleListCategories(db, w, r, session)
+			return
+		}
+
+		if !session.IsAdmin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			handleCreateCategory(db, w, r)
+		case http.MethodPut:
+			handleUpdateCategory(db, w, r)
+		case http.MethodDelete:
+			handleArchiveCategory(db, w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// handleListCategories returns active categories in display order. Admins may
+// pass ?include_archived=true to see archived ones as well.
+func handleListCategories(db *sql.DB, w http.ResponseWriter, r *http.Request, session *models.Session) {
+	includeArchived := session.IsAdmin && r.URL.Query().Get("include_archived") == "true"
+
+	rows, err := db.Query(`
+		SELECT c.slug, c.name, c.description, c.position, c.archived, c.created_at,
+			(SELECT COUNT(*) FROM post_categories pc JOIN posts p ON p.id = pc.post_id
+				WHERE pc.category_slug = c.slug AND p.deleted_at IS NULL)
+		FROM categories c
+		WHERE c.archived = 0 OR ?
+		ORDER BY c.position ASC, c.name COLLATE NOCASE ASC`,
+		includeArchived,
+	)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.Slug, &c.Name, &c.Description, &c.Position, &c.Archived, &c.CreatedAt, &c.PostCount); err != nil {
+			http.Error(w, "Error scanning category", http.StatusInternalServerError)
+			return
+		}
+		categories = append(categories, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+// handleCreateCategory adds a new category
+func handleCreateCategory(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	var req categoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid category data", http.StatusBadRequest)
+		return
+	}
+
+	c := models.Category{
+		Slug:      strings.ToLower(strings.TrimSpace(req.Slug)),
+		CreatedAt: time.Now(),
+	}
+	if req.Name != nil {
+		c.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		c.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Position != nil {
+		c.Position = *req.Position
+	}
+
+	if !categorySlugPattern.MatchString(c.Slug) {
+		http.Error(w, "Slug must be 2-32 lowercase letters, digits or dashes", http.StatusBadRequest)
+		return
+	}
+	if c.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO categories (slug, name, description, position, archived, created_at)
+		VALUES (?, ?, ?, ?, 0, ?)`,
+		c.Slug, c.Name, c.Description, c.Position, c.CreatedAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			http.Error(w, "Category already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("Database error: %v", err)
+		http.Error(w, "Failed to save category", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+// handleUpdateCategory renames, reorders or (un)archives a category. The
+// slug never changes, so existing posts keep pointing at it.
+func handleUpdateCategory(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	slug := r.URL.Query().Get("slug")
+	if slug == "" {
+		http.Error(w, "Slug is required", http.StatusBadRequest)
+		return
+	}
+
+	var req categoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid category data", http.StatusBadRequest)
+		return
+	}
+
+	c, err := getCategory(db, slug)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error: %v", err)
+		http.Error(w, "Failed to fetch category", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Name != nil {
+		c.Name = strings.TrimSpace(*req.Name)
+		if c.Name == "" {
+			http.Error(w, "Name cannot be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Description != nil {
+		c.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Position != nil {
+		c.Position = *req.Position
+	}
+	if req.Archived != nil {
+		c.Archived = *req.Archived
+	}
+
+	_, err = db.Exec(`
+		UPDATE categories SET name = ?, description = ?, position = ?, archived = ?
+		WHERE slug = ?`,
+		c.Name, c.Description, c.Position, c.Archived, c.Slug,
+	)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		http.Error(w, "Failed to update category", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// handleArchiveCategory hides a category from listings and new posts
+func handleArchiveCategory(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	slug := r.URL.Query().Get("slug")
+	if slug == "" {
+		http.Error(w, "Slug is required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.Exec(`UPDATE categories SET archived = 1 WHERE slug = ?`, slug)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		http.Error(w, "Failed to archive category", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getCategory loads a single category with its post count
+func getCategory(db *sql.DB, slug string) (*models.Category, error) {
+	var c models.Category
+	err := db.QueryRow(`
+		SELECT c.slug, c.name, c.description, c.position, c.archived, c.created_at,
+			(SELECT COUNT(*) FROM post_categories pc JOIN posts p ON p.id = pc.post_id
+				WHERE pc.category_slug = c.slug AND p.deleted_at IS NULL)
+		FROM categories c
+		WHERE c.slug = ?`,
+		slug,
+	).Scan(&c.Slug, &c.Name, &c.Description, &c.Position, &c.Archived, &c.CreatedAt, &c.PostCount)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// activeCategoryExists reports whether posts may be filed under slug
+func activeCategoryExists(db *sql.DB, slug string) (bool, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM categories WHERE slug = ? AND archived = 0`, slug).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"real-time-forum/models"
+)
+
+// ChatUsersHandler lists every other user for the chat sidebar. Users the
+// current user has messaged come first, most recent conversation on top,
+// followed by everyone else in alphabetical order.
+func ChatUsersHandler(db *sql.DB, sessions SessionStore, hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := GetSession(sessions, r)
+		if session == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT u.id, u.nickname, c.last_message_at,
+				(SELECT COUNT(*) FROM messages m
+				 LEFT JOIN conversation_reads cr
+					ON cr.conversation_id = m.conversation_id AND cr.user_id = ?
+				 WHERE m.conversation_id = c.id AND m.sender_id = u.id
+					AND (cr.last_read_at IS NULL OR m.created_at > cr.last_read_at))
+			FROM users u
+			LEFT JOIN conversations c
+				ON (c.user_one_id = ? AND c.user_two_id = u.id)
+				OR (c.user_two_id = ? AND c.user_one_id = u.id)
+			WHERE u.id != ?
+			ORDER BY c.last_message_at IS NULL, c.last_message_at DESC, u.nickname COLLATE NOCASE ASC`,
+			session.UserID, session.UserID, session.UserID, session.UserID,
+		)
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		users := []models.ChatUser{}
+		for rows.Next() {
+			var u models.ChatUser
+			var lastAt sql.NullTime
+			if err := rows.Scan(&u.UserID, &u.Nickname, &lastAt, &u.UnreadCount); err != nil {
+				http.Error(w, "Error scanning user", http.StatusInternalServerError)
+				return
+			}
+			if lastAt.Valid {
+				u.LastMessageAt = &lastAt.Time
+			}
+			u.Online = hub.IsOnline(u.UserID)
+			users = append(users, u)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(users)
+	}
+}
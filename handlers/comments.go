@@ -3,16 +3,30 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
 	"real-time-forum/models"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
 )
 
-// GetPostWithComments retrieves a single post with all its comments
-func GetPostWithComments(db *sql.DB) http.HandlerFunc {
+// GetPostWithComments retrieves a single post with a page of its comment
+// tree, flattened depth-first. It takes the same sort, limit and cursor
+// parameters as GET /api/comments.
+func GetPostWithComments(db *sql.DB, sessions SessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		session := GetSession(sessions, r)
+		if session == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
 		postID := r.URL.Query().Get("id")
 		if postID == "" {
 			http.Error(w, "Post ID is required", http.StatusBadRequest)
@@ -20,16 +34,7 @@ func GetPostWithComments(db *sql.DB) http.HandlerFunc {
 		}
 
 		// First, get the post
-		var post models.Post
-		err := db.QueryRow(`
-			SELECT id, user_id, category_id, title, content, likes, dislikes, created_at 
-			FROM posts 
-			WHERE id = ?
-		`, postID).Scan(
-			&post.ID, &post.UserID, &post.CategoryID, &post.Title, &post.Content, 
-			&post.LikeCount, &post.DislikeCount, &post.CreatedAt,
-		)
-		
+		post, err := getPost(db, postID, session.UserID)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				http.Error(w, "Post not found", http.StatusNotFound)
@@ -39,39 +44,28 @@ func GetPostWithComments(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Then, get all comments for this post
-		rows, err := db.Query(`
-			SELECT id, post_id, user_id, body, created_at 
-			FROM comments 
-			WHERE post_id = ? 
-			ORDER BY created_at ASC
-		`, postID)
-		
+		// Then, a page of comments with a preview of their replies
+		page, err := parseCommentPage(r.URL.Query())
 		if err != nil {
-			http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		defer rows.Close()
-
-		// Prepare response structure
-		var comments []models.Comment
-		for rows.Next() {
-			var c models.Comment
-			err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Body, &c.CreatedAt)
-			if err != nil {
-				http.Error(w, "Error scanning comment", http.StatusInternalServerError)
-				return
-			}
-			comments = append(comments, c)
+		comments, nextCursor, err := loadCommentPage(db, postID, "", session.UserID, 0, page)
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+			return
 		}
 
 		// Combine post and comments in one response
 		response := struct {
-			Post     models.Post      `json:"post"`
-			Comments []models.Comment `json:"comments"`
+			Post       models.Post      `json:"post"`
+			Comments   []models.Comment `json:"comments"`
+			NextCursor string           `json:"next_cursor"`
 		}{
-			Post:     post,
-			Comments: comments,
+			Post:       *post,
+			Comments:   comments,
+			NextCursor: nextCursor,
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -79,48 +73,264 @@ func GetPostWithComments(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// CreateComment handles adding a new comment to a post
-func CreateComment(db *sql.DB) http.HandlerFunc {
+// CommentsHandler lists (GET) and creates (POST) comments and lets their authors or a
+// moderator edit (PUT ?id=) and delete (DELETE ?id=) them. Authors can only
+// edit within editWindow of posting; zero means no limit. Every change is
+// streamed to everyone viewing the post.
+func CommentsHandler(db *sql.DB, sessions SessionStore, hub *Hub, editWindow time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
+		session := GetSession(sessions, r)
+		if session == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			handleListComments(db, w, r, session)
+		case http.MethodPost:
+			handleCreateComment(db, hub, w, r, session)
+		case http.MethodPut:
+			handleUpdateComment(db, hub, w, r, session, editWindow)
+		case http.MethodDelete:
+			handleDeleteComment(db, hub, w, r, session)
+		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// handleCreateComment adds a new comment to a post, or a reply to one of
+// its comments when parent_comment_id is set
+func handleCreateComment(db *sql.DB, hub *Hub, w http.ResponseWriter, r *http.Request, session *models.Session) {
+	var req struct {
+		PostID   string `json:"post_id"`
+		ParentID string `json:"parent_comment_id"`
+		Content  string `json:"content"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid comment data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate required fields
+	comment := models.Comment{
+		PostID:   req.PostID,
+		ParentID: req.ParentID,
+		Content:  strings.TrimSpace(req.Content),
+	}
+	if comment.PostID == "" || comment.Content == "" {
+		http.Error(w, "Post ID and comment content are required", http.StatusBadRequest)
+		return
+	}
+
+	var postExists int
+	err = db.QueryRow(`SELECT COUNT(*) FROM posts WHERE id = ? AND deleted_at IS NULL`, comment.PostID).Scan(&postExists)
+	if err != nil {
+		http.Error(w, "Failed to fetch post", http.StatusInternalServerError)
+		return
+	}
+	if postExists == 0 {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	// Replies must go under a live comment on the same post
+	var parentAuthorID string
+	if comment.ParentID != "" {
+		err = db.QueryRow(`
+			SELECT user_id FROM comments WHERE id = ? AND post_id = ? AND deleted_at IS NULL`,
+			comment.ParentID, comment.PostID,
+		).Scan(&parentAuthorID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Parent comment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch parent comment", http.StatusInternalServerError)
 			return
 		}
 
-		var comment models.Comment
-		err := json.NewDecoder(r.Body).Decode(&comment)
+		err = db.QueryRow(`
+			WITH RECURSIVE ancestors(id, parent_id) AS (
+				SELECT id, parent_comment_id FROM comments WHERE id = ?
+				UNION ALL
+				SELECT c.id, c.parent_comment_id FROM comments c JOIN ancestors a ON c.id = a.parent_id
+			)
+			SELECT COUNT(*) FROM ancestors`,
+			comment.ParentID,
+		).Scan(&comment.Depth)
 		if err != nil {
-			http.Error(w, "Invalid comment data", http.StatusBadRequest)
+			http.Error(w, "Failed to fetch parent comment", http.StatusInternalServerError)
 			return
 		}
+	}
+
+	// The author always comes from the session, never the request body
+	comment.UserID = session.UserID
+	comment.Nickname = session.Nickname
+
+	// Generate UUID and timestamp
+	commentID, err := uuid.NewV4()
+	if err != nil {
+		http.Error(w, "Failed to generate comment ID", http.StatusInternalServerError)
+		return
+	}
+	comment.ID = commentID.String()
+	comment.CreatedAt = time.Now()
+
+	// Insert into database
+	_, err = db.Exec(`
+		INSERT INTO comments (id, post_id, parent_comment_id, user_id, nickname, content, created_at)
+		VALUES (?, ?, NULLIF(?, ''), ?, ?, ?, ?)
+	`, comment.ID, comment.PostID, comment.ParentID, comment.UserID, comment.Nickname, comment.Content, comment.CreatedAt)
+	
+	if err != nil {
+		http.Error(w, "Failed to save comment", http.StatusInternalServerError)
+		return
+	}
 
-		// Validate required fields
-		if comment.PostID == "" || comment.UserID == "" || comment.Body == "" {
-			http.Error(w, "Post ID, User ID, and comment body are required", http.StatusBadRequest)
+	broadcastToPost(hub, comment.PostID, "comment.created", comment)
+
+	// Let the parent's author know someone replied, wherever they are
+	if parentAuthorID != "" && parentAuthorID != session.UserID {
+		hub.SendToUser(parentAuthorID, "comment.reply", comment)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// handleUpdateComment replaces the content of a comment
+func handleUpdateComment(db *sql.DB, hub *Hub, w http.ResponseWriter, r *http.Request, session *models.Session, editWindow time.Duration) {
+	commentID := r.URL.Query().Get("id")
+	if commentID == "" {
+		http.Error(w, "Comment ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid comment data", http.StatusBadRequest)
+		return
+	}
+	req.Content = strings.TrimSpace(req.Content)
+	if req.Content == "" {
+		http.Error(w, "Comment content is required", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := getComment(db, commentID, session.UserID)
+	if err == sql.ErrNoRows || (err == nil && comment.Deleted) {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error: %v", err)
+		http.Error(w, "Failed to fetch comment", http.StatusInternalServerError)
+		return
+	}
+
+	if !session.IsAdmin {
+		if comment.UserID != session.UserID {
+			http.Error(w, "You can only edit your own comments", http.StatusForbidden)
 			return
 		}
-
-		// Generate UUID and timestamp
-		commentID, err := uuid.NewV4()
-		if err != nil {
-			http.Error(w, "Failed to generate comment ID", http.StatusInternalServerError)
+		if editWindow > 0 && time.Since(comment.CreatedAt) > editWindow {
+			http.Error(w, "Comments can only be edited for "+editWindow.String()+" after posting", http.StatusForbidden)
 			return
 		}
-		comment.ID = commentID.String()
-		comment.CreatedAt = time.Now()
-
-		// Insert into database
-		_, err = db.Exec(`
-			INSERT INTO comments (id, post_id, user_id, body, created_at)
-			VALUES (?, ?, ?, ?, ?)
-		`, comment.ID, comment.PostID, comment.UserID, comment.Body, comment.CreatedAt)
-		
+	}
+
+	if req.Content != comment.Content {
+		_, err = db.Exec(`UPDATE comments SET content = ?, edited_at = ? WHERE id = ?`,
+			req.Content, time.Now(), commentID)
 		if err != nil {
-			http.Error(w, "Failed to save comment", http.StatusInternalServerError)
+			log.Printf("Database error: %v", err)
+			http.Error(w, "Failed to update comment", http.StatusInternalServerError)
 			return
 		}
+		comment.Content = req.Content
+		comment.Edited = true
+	}
 
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(comment)
+	// Viewers get the new text without the editor's own reaction
+	update := *comment
+	update.UserReaction = ""
+	broadcastToPost(hub, comment.PostID, "comment.updated", update)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// handleDeleteComment soft-deletes a comment. It stays in the thread as a
+// tombstone so replies and counts keep their place.
+func handleDeleteComment(db *sql.DB, hub *Hub, w http.ResponseWriter, r *http.Request, session *models.Session) {
+	commentID := r.URL.Query().Get("id")
+	if commentID == "" {
+		http.Error(w, "Comment ID is required", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := getComment(db, commentID, session.UserID)
+	if err == sql.ErrNoRows || (err == nil && comment.Deleted) {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Database error: %v", err)
+		http.Error(w, "Failed to fetch comment", http.StatusInternalServerError)
+		return
+	}
+
+	if comment.UserID != session.UserID && !session.IsAdmin {
+		http.Error(w, "You can only delete your own comments", http.StatusForbidden)
+		return
+	}
+
+	_, err = db.Exec(`UPDATE comments SET deleted_at = ? WHERE id = ?`, time.Now(), commentID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+		return
 	}
-}
\ No newline at end of file
+
+	tombstoneComment(comment)
+	broadcastToPost(hub, comment.PostID, "comment.deleted", comment)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getComment loads a comment on a live post with userID's reaction to it
+func getComment(db *sql.DB, commentID, userID string) (*models.Comment, error) {
+	var c models.Comment
+	err := db.QueryRow(`
+		SELECT c.id, c.post_id, c.user_id, c.nickname, c.content, c.likes, c.dislikes,
+			COALESCE(r.reaction, ''), c.edited_at IS NOT NULL, c.deleted_at IS NOT NULL, c.created_at
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+		LEFT JOIN reactions r
+			ON r.target_type = 'comment' AND r.target_id = c.id AND r.user_id = ?
+		WHERE c.id = ?`,
+		userID, commentID,
+	).Scan(&c.ID, &c.PostID, &c.UserID, &c.Nickname, &c.Content,
+		&c.LikeCount, &c.DislikeCount, &c.UserReaction, &c.Edited, &c.Deleted, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// tombstoneComment blanks out a deleted comment, keeping only where it sat
+// in the thread
+func tombstoneComment(c *models.Comment) {
+	c.UserID = ""
+	c.Nickname = ""
+	c.Content = "[deleted]"
+	c.LikeCount = 0
+	c.DislikeCount = 0
+	c.UserReaction = ""
+	c.Edited = false
+	c.Deleted = true
+}
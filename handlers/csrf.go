@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+const (
+	csrfCookieName = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// CSRFMiddleware guards state-changing requests. Each session has its own
+// random token, stored with it; unsafe methods must send that token in the
+// X-CSRF-Token header. The page's scripts read it from the csrf_token
+// cookie, which only delivers it: the check is against the session, so a
+// cookie planted by someone else gets them nowhere.
+//
+// Visitors who aren't logged in have no session, so the login and signup
+// forms fall back to a double-submit check of the header against the
+// cookie.
+func CSRFMiddleware(sessions SessionStore, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookieToken := ""
+		if cookie, err := r.Cookie(csrfCookieName); err == nil {
+			cookieToken = cookie.Value
+		}
+
+		expected := cookieToken
+		if session := GetSession(sessions, r); session != nil {
+			expected = session.CSRFToken
+			// Keep the page's copy in step with the session
+			if expected != "" && cookieToken != expected {
+				setCSRFCookie(w, expected)
+			}
+		} else if cookieToken == "" {
+			token, err := newCSRFToken()
+			if err != nil {
+				log.Printf("CSRF token error: %v", err)
+			} else {
+				setCSRFCookie(w, token)
+			}
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get(csrfHeaderName)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(header), []byte(expected)) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "CSRF token missing or invalid"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newCSRFToken returns a random token
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// setCSRFCookie hands a token to the page's scripts
+func setCSRFCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+	})
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	store := NewMemorySessionStore(testSessionConfig)
+	sess := createTestSession(t, store, false)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := CSRFMiddleware(store, ok)
+
+	tests := []struct {
+		name       string
+		method     string
+		sessionID  string
+		cookie     string
+		header     string
+		wantStatus int
+	}{
+		{"safe method needs no token", http.MethodGet, "", "", "", http.StatusOK},
+		{"logged out, header matches cookie", http.MethodPost, "", "anon", "anon", http.StatusOK},
+		{"logged out, no header", http.MethodPost, "", "anon", "", http.StatusForbidden},
+		{"logged out, header differs from cookie", http.MethodPost, "", "anon", "other", http.StatusForbidden},
+		{"logged out, no cookie", http.MethodPost, "", "", "anon", http.StatusForbidden},
+		{"logged in, session token", http.MethodPost, sess.ID, sess.CSRFToken, sess.CSRFToken, http.StatusOK},
+		{"logged in, session token without cookie", http.MethodDelete, sess.ID, "", sess.CSRFToken, http.StatusOK},
+		{"logged in, planted cookie", http.MethodPost, sess.ID, "planted", "planted", http.StatusForbidden},
+		{"logged in, no header", http.MethodPost, sess.ID, sess.CSRFToken, "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/posts", nil)
+			if tt.sessionID != "" {
+				r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: tt.sessionID})
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(csrfHeaderName, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code == http.StatusForbidden {
+				var body map[string]string
+				if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body["error"] == "" {
+					t.Errorf("403 body = %q, want a JSON error", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCSRFMiddlewareHandsOutTokens(t *testing.T) {
+	store := NewMemorySessionStore(testSessionConfig)
+	sess := createTestSession(t, store, false)
+	handler := CSRFMiddleware(store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	csrfCookie := func(w *httptest.ResponseRecorder) string {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == csrfCookieName {
+				return c.Value
+			}
+		}
+		return ""
+	}
+
+	// A new visitor gets a token to submit with the login form
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if csrfCookie(w) == "" {
+		t.Error("no CSRF cookie set for a visitor without one")
+	}
+
+	// A logged-in page with a stale copy is given the session's token
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: sess.ID})
+	r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "stale"})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := csrfCookie(w); got != sess.CSRFToken {
+		t.Errorf("CSRF cookie = %q, want the session's token", got)
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// encodeCursor builds an opaque pagination cursor from a timestamp and row ID
+func encodeCursor(at time.Time, id string) string {
+	raw := at.Format(time.RFC3339Nano) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor reverses encodeCursor
+func decodeCursor(cursor string) (time.Time, string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	at, id, found := strings.Cut(string(raw), "|")
+	if !found || id == "" {
+		return time.Time{}, "", false
+	}
+	t, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return t, id, true
+}
+
+// keyCursor is the payload of a keyset cursor: the sort it belongs to and
+// the sort-key values of the last row on the previous page
+type keyCursor struct {
+	Sort string        `json:"s"`
+	Keys []interface{} `json:"k"`
+}
+
+// encodeKeyCursor builds an opaque cursor from the last row's sort keys
+func encodeKeyCursor(sort string, keys ...interface{}) string {
+	raw, err := json.Marshal(keyCursor{Sort: sort, Keys: keys})
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeKeyCursor reverses encodeKeyCursor, rejecting cursors issued for a
+// different sort or with the wrong number of keys
+func decodeKeyCursor(cursor, sort string, numKeys int) ([]interface{}, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var kc keyCursor
+	if err := dec.Decode(&kc); err != nil || kc.Sort != sort || len(kc.Keys) != numKeys {
+		return nil, false
+	}
+
+	// Numbers go back to SQLite as integers, everything else must be a string
+	for i, key := range kc.Keys {
+		switch v := key.(type) {
+		case json.Number:
+			n, err := v.Int64()
+			if err != nil {
+				return nil, false
+			}
+			kc.Keys[i] = n
+		case string:
+		default:
+			return nil, false
+		}
+	}
+	return kc.Keys, true
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 45, 123456789, time.UTC)
+	cursor := encodeCursor(at, "msg-42")
+
+	gotAt, gotID, ok := decodeCursor(cursor)
+	if !ok {
+		t.Fatalf("decodeCursor(%q) failed", cursor)
+	}
+	if !gotAt.Equal(at) || gotID != "msg-42" {
+		t.Errorf("decodeCursor = %v, %q; want %v, %q", gotAt, gotID, at, "msg-42")
+	}
+}
+
+func TestDecodeCursorRejectsInvalid(t *testing.T) {
+	for _, cursor := range []string{
+		"",
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("no separator")),
+		base64.RawURLEncoding.EncodeToString([]byte("2024-03-01T12:00:00Z|")),
+		base64.RawURLEncoding.EncodeToString([]byte("yesterday|msg-1")),
+	} {
+		if _, _, ok := decodeCursor(cursor); ok {
+			t.Errorf("decodeCursor(%q) succeeded", cursor)
+		}
+	}
+}
+
+func TestKeyCursorRoundTrip(t *testing.T) {
+	// Ints come back as int64 for SQLite, strings as strings
+	cursor := encodeKeyCursor("top", 7, "2024-03-01 12:00:00", "comment-1")
+	keys, ok := decodeKeyCursor(cursor, "top", 3)
+	if !ok {
+		t.Fatalf("decodeKeyCursor(%q) failed", cursor)
+	}
+	want := []interface{}{int64(7), "2024-03-01 12:00:00", "comment-1"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("decodeKeyCursor = %#v, want %#v", keys, want)
+	}
+}
+
+func TestDecodeKeyCursorRejectsInvalid(t *testing.T) {
+	valid := encodeKeyCursor("newest", "2024-03-01", "post-1")
+	tests := []struct {
+		name    string
+		cursor  string
+		sort    string
+		numKeys int
+	}{
+		{"other sort", valid, "oldest", 2},
+		{"wrong key count", valid, "newest", 3},
+		{"not base64", "not base64!", "newest", 2},
+		{"not json", base64.RawURLEncoding.EncodeToString([]byte("{")), "newest", 2},
+		{"fractional key", encodeKeyCursor("top", 1.5, "post-1"), "top", 2},
+		{"bool key", encodeKeyCursor("top", true, "post-1"), "top", 2},
+	}
+	for _, tt := range tests {
+		if _, ok := decodeKeyCursor(tt.cursor, tt.sort, tt.numKeys); ok {
+			t.Errorf("%s: decodeKeyCursor succeeded", tt.name)
+		}
+	}
+}
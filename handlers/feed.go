@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"real-time-forum/models"
+	"strings"
+)
+
+type feedSubscribeEvent struct {
+	Categories []string `json:"categories"`
+}
+
+type postSubscribeEvent struct {
+	PostID string `json:"post_id"`
+}
+
+// RegisterFeedEvents wires the feed subscription client events into the hub.
+// Clients send feed.subscribe with {"categories": [...]} to narrow the live
+// post feed, or an empty list (or "all") to receive every new post, and
+// post.subscribe/post.unsubscribe with {"post_id": ...} while a post is open.
+func RegisterFeedEvents(hub *Hub) {
+	hub.On("feed.subscribe", func(c *Client, data json.RawMessage) {
+		var ev feedSubscribeEvent
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &ev); err != nil {
+				c.Send("error", map[string]string{"error": "Invalid feed subscription"})
+				return
+			}
+		}
+
+		var categories []string
+		for _, category := range ev.Categories {
+			category = strings.TrimSpace(category)
+			if category == "all" {
+				categories = nil
+				break
+			}
+			if category != "" {
+				categories = append(categories, category)
+			}
+		}
+		c.SetCategories(categories)
+		c.Send("feed.subscribed", map[string]interface{}{"categories": categories})
+	})
+
+	hub.On("post.subscribe", func(c *Client, data json.RawMessage) {
+		var ev postSubscribeEvent
+		if err := json.Unmarshal(data, &ev); err != nil || ev.PostID == "" {
+			c.Send("error", map[string]string{"error": "post_id is required"})
+			return
+		}
+		if !c.SubscribePost(ev.PostID) {
+			c.Send("error", map[string]string{"error": "Too many open posts"})
+			return
+		}
+		c.Send("post.subscribed", ev)
+	})
+
+	hub.On("post.unsubscribe", func(c *Client, data json.RawMessage) {
+		var ev postSubscribeEvent
+		if err := json.Unmarshal(data, &ev); err != nil || ev.PostID == "" {
+			c.Send("error", map[string]string{"error": "post_id is required"})
+			return
+		}
+		c.UnsubscribePost(ev.PostID)
+	})
+}
+
+// broadcastPost fans a newly created post out to connections subscribed to
+// any of its categories
+func broadcastPost(hub *Hub, post models.Post) {
+	hub.broadcastWhere("post.created", post, func(c *Client) bool {
+		for _, category := range post.Categories {
+			if c.WantsCategory(category) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// broadcastToPost sends an event to connections that have the post open
+func broadcastToPost(hub *Hub, postID, eventType string, data interface{}) {
+	hub.broadcastWhere(eventType, data, func(c *Client) bool {
+		return c.WatchesPost(postID)
+	})
+}
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"real-time-forum/models"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer
+	writeWait = 10 * time.Second
+
+	// Time allowed to read the next pong message from the peer
+	pongWait = 60 * time.Second
+
+	// Send pings to peer with this period (must be less than pongWait)
+	pingPeriod = (pongWait * 9) / 10
+
+	// Maximum message size allowed from peer
+	maxMessageSize = 8192
+
+	// Outgoing messages buffered per connection before it is dropped
+	sendBufferSize = 64
+
+	// Posts a single connection may watch for live comments at once
+	maxPostSubscriptions = 20
+)
+
+// Event is the JSON envelope pushed to clients over the WebSocket
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// incomingEvent is the JSON envelope clients send over the WebSocket
+type incomingEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// EventHandlerFunc handles one incoming event type from a client
+type EventHandlerFunc func(c *Client, data json.RawMessage)
+
+// Client is a single authenticated WebSocket connection
+type Client struct {
+	hub       *Hub
+	conn      *websocket.Conn
+	send      chan []byte
+	sessions  SessionStore
+	SessionID string
+	UserID    string
+	Nickname  string
+
+	// Feed subscriptions; nil categories means every category
+	subMu      sync.RWMutex
+	categories map[string]bool
+	posts      map[string]bool
+}
+
+// Hub tracks open WebSocket connections per user ID and fans out events.
+// A user is online while at least one of their connections is open.
+type Hub struct {
+	mu       sync.RWMutex
+	clients  map[string]map[*Client]bool
+	handlers map[string]EventHandlerFunc
+	lastSeen map[string]time.Time
+}
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{
+		clients:  make(map[string]map[*Client]bool),
+		handlers: make(map[string]EventHandlerFunc),
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+// On registers a handler for an incoming event type
+func (h *Hub) On(eventType string, fn EventHandlerFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers[eventType] = fn
+}
+
+// register adds a client to the hub, announcing the user if it is their first connection
+func (h *Hub) register(c *Client) {
+	h.mu.Lock()
+	conns, ok := h.clients[c.UserID]
+	if !ok {
+		conns = make(map[*Client]bool)
+		h.clients[c.UserID] = conns
+	}
+	conns[c] = true
+	now := time.Now()
+	h.lastSeen[c.UserID] = now
+
+	// Queued before unlocking so a quick unregister can't overtake it
+	var slow []*Client
+	if !ok {
+		slow = h.queueEvent("presence.online", models.OnlineUser{
+			UserID:   c.UserID,
+			Nickname: c.Nickname,
+			LastSeen: now,
+		}, nil)
+	}
+	h.mu.Unlock()
+	dropSlow(slow)
+}
+
+// unregister removes a client from the hub and closes its send channel,
+// announcing the user as offline once their last connection is gone
+func (h *Hub) unregister(c *Client) {
+	h.mu.Lock()
+	conns, ok := h.clients[c.UserID]
+	if !ok || !conns[c] {
+		h.mu.Unlock()
+		return
+	}
+	delete(conns, c)
+	close(c.send)
+	offline := len(conns) == 0
+	if offline {
+		delete(h.clients, c.UserID)
+	}
+	now := time.Now()
+	h.lastSeen[c.UserID] = now
+
+	// Queued before unlocking, like presence.online in register
+	var slow []*Client
+	if offline {
+		slow = h.queueEvent("presence.offline", models.OnlineUser{
+			UserID:   c.UserID,
+			Nickname: c.Nickname,
+			LastSeen: now,
+		}, nil)
+	}
+	h.mu.Unlock()
+	dropSlow(slow)
+}
+
+// CloseSession disconnects every connection opened with a session, telling
+// the client why first. The read pumps then unregister them as usual.
+func (h *Hub) CloseSession(sessionID string) {
+	h.mu.RLock()
+	var targets []*Client
+	for _, conns := range h.clients {
+		for c := range conns {
+			if c.SessionID == sessionID {
+				targets = append(targets, c)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range targets {
+		msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked")
+		c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+		c.conn.Close()
+	}
+}
+
+// RebindSession moves connections opened with a session to its new ID
+// after rotation, so revoking the session still closes them
+func (h *Hub) RebindSession(oldID, newID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, conns := range h.clients {
+		for c := range conns {
+			if c.SessionID == oldID {
+				c.SessionID = newID
+			}
+		}
+	}
+}
+
+// touch records activity from a user's connection
+func (h *Hub) touch(userID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSeen[userID] = time.Now()
+}
+
+// pruneLastSeen forgets when offline users were last seen once that is
+// older than ttl, returning how many were dropped
+func (h *Hub) pruneLastSeen(ttl time.Duration) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cutoff := time.Now().Add(-ttl)
+	var n int64
+	for userID, seen := range h.lastSeen {
+		if len(h.clients[userID]) == 0 && seen.Before(cutoff) {
+			delete(h.lastSeen, userID)
+			n++
+		}
+	}
+	return n
+}
+
+// IsOnline reports whether the user has at least one open connection
+func (h *Hub) IsOnline(userID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[userID]) > 0
+}
+
+// OnlineUsers returns a snapshot of connected users, most recently seen first
+func (h *Hub) OnlineUsers() []models.OnlineUser {
+	h.mu.RLock()
+	users := []models.OnlineUser{}
+	for userID, conns := range h.clients {
+		for c := range conns {
+			users = append(users, models.OnlineUser{
+				UserID:   userID,
+				Nickname: c.Nickname,
+				LastSeen: h.lastSeen[userID],
+			})
+			break
+		}
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].LastSeen.After(users[j].LastSeen)
+	})
+	return users
+}
+
+// Broadcast sends an event to every connected user
+func (h *Hub) Broadcast(eventType string, data interface{}) {
+	h.broadcastWhere(eventType, data, nil)
+}
+
+// SendToUser sends an event to all open connections of a single user
+func (h *Hub) SendToUser(userID, eventType string, data interface{}) {
+	h.broadcastWhere(eventType, data, func(c *Client) bool {
+		return c.UserID == userID
+	})
+}
+
+// broadcastWhere sends an event to every connection accepted by filter
+func (h *Hub) broadcastWhere(eventType string, data interface{}, filter func(c *Client) bool) {
+	// Queue under the read lock so unregister can't close a channel mid-send
+	h.mu.RLock()
+	slow := h.queueEvent(eventType, data, filter)
+	h.mu.RUnlock()
+	dropSlow(slow)
+}
+
+// queueEvent puts an event on the send buffer of every connection accepted
+// by filter and returns the connections whose buffer was full. The caller
+// must hold h.mu.
+func (h *Hub) queueEvent(eventType string, data interface{}, filter func(c *Client) bool) []*Client {
+	msg, err := json.Marshal(Event{Type: eventType, Data: data})
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", eventType, err)
+		return nil
+	}
+
+	var slow []*Client
+	for _, conns := range h.clients {
+		for c := range conns {
+			if filter != nil && !filter(c) {
+				continue
+			}
+			select {
+			case c.send <- msg:
+			default:
+				slow = append(slow, c)
+			}
+		}
+	}
+	return slow
+}
+
+// dropSlow closes connections that can't keep up. Closing a connection ends
+// its read pump, which unregisters it.
+func dropSlow(slow []*Client) {
+	for _, c := range slow {
+		log.Printf("Dropping slow WebSocket client for user %s", c.UserID)
+		c.conn.Close()
+	}
+}
+
+// Send pushes an event to this connection only
+func (c *Client) Send(eventType string, data interface{}) {
+	c.hub.broadcastWhere(eventType, data, func(other *Client) bool {
+		return other == c
+	})
+}
+
+// SetCategories replaces the categories this connection receives posts for.
+// An empty list subscribes to every category.
+func (c *Client) SetCategories(categories []string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	if len(categories) == 0 {
+		c.categories = nil
+		return
+	}
+	c.categories = make(map[string]bool, len(categories))
+	for _, category := range categories {
+		c.categories[category] = true
+	}
+}
+
+// WantsCategory reports whether the connection is subscribed to a category
+func (c *Client) WantsCategory(category string) bool {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	return c.categories == nil || c.categories[category]
+}
+
+// SubscribePost starts streaming a post's comments to this connection,
+// reporting false if the connection already watches too many posts
+func (c *Client) SubscribePost(postID string) bool {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	if c.posts == nil {
+		c.posts = make(map[string]bool)
+	}
+	if !c.posts[postID] && len(c.posts) >= maxPostSubscriptions {
+		return false
+	}
+	c.posts[postID] = true
+	return true
+}
+
+// UnsubscribePost stops streaming a post's comments to this connection
+func (c *Client) UnsubscribePost(postID string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	delete(c.posts, postID)
+}
+
+// WatchesPost reports whether the connection has the post open
+func (c *Client) WatchesPost(postID string) bool {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	return c.posts[postID]
+}
+
+// readPump reads incoming events and dispatches them to registered handlers
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister(c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	// A missed pong lets the read deadline expire, which drops the connection
+	// and marks the user offline if it was their last one
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.hub.touch(c.UserID)
+		return nil
+	})
+
+	for {
+		_, raw, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("WebSocket read error: %v", err)
+			}
+			return
+		}
+
+		c.hub.touch(c.UserID)
+
+		var ev incomingEvent
+		if err := json.Unmarshal(raw, &ev); err != nil || ev.Type == "" {
+			c.Send("error", map[string]string{"error": "Invalid event"})
+			continue
+		}
+
+		c.hub.mu.RLock()
+		fn, ok := c.hub.handlers[ev.Type]
+		c.hub.mu.RUnlock()
+		if !ok {
+			c.Send("error", map[string]string{"error": "Unknown event type: " + ev.Type})
+			continue
+		}
+		fn(c, ev.Data)
+	}
+}
+
+// writePump writes queued messages and keepalive pings to the connection
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub closed the channel
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			// The session may have idled out, ended or been purged since
+			// the connection opened
+			if !c.sessionAlive() {
+				msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session expired")
+				c.conn.WriteMessage(websocket.CloseMessage, msg)
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sessionAlive reports whether the connection's session still exists. A
+// failed lookup keeps the connection open; only a missing session ends it.
+func (c *Client) sessionAlive() bool {
+	c.hub.mu.RLock()
+	id := c.SessionID
+	c.hub.mu.RUnlock()
+	_, err := c.sessions.Get(id)
+	return err != ErrSessionNotFound
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTestHub opens a WebSocket to hub as the holder of sessionID and waits
+// until the hub has registered it
+func dialTestHub(t *testing.T, sessions SessionStore, hub *Hub, sessionID string) *websocket.Conn {
+	t.Helper()
+	srv := httptest.NewServer(WebSocketHandler(sessions, hub))
+	t.Cleanup(srv.Close)
+
+	header := http.Header{}
+	header.Set("Cookie", sessionCookieName+"="+sessionID)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	deadline := time.Now().Add(time.Second)
+	for !hubHasSession(hub, sessionID) {
+		if time.Now().After(deadline) {
+			t.Fatal("hub never registered the connection")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return conn
+}
+
+func hubHasSession(hub *Hub, sessionID string) bool {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	for _, conns := range hub.clients {
+		for c := range conns {
+			if c.SessionID == sessionID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// waitForClose reads until the connection ends and returns how it was
+// closed, or nil if it stayed open for the whole wait
+func waitForClose(t *testing.T, conn *websocket.Conn, wait time.Duration) *websocket.CloseError {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(wait))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			return closeErr
+		}
+		if netErr, ok := err.(interface{ Timeout() bool }); ok && netErr.Timeout() {
+			return nil
+		}
+		t.Fatalf("read error: %v", err)
+	}
+}
+
+func TestHubCloseSession(t *testing.T) {
+	store := NewMemorySessionStore(testSessionConfig)
+	hub := NewHub()
+	revoked := createTestSession(t, store, false)
+	other := createTestSession(t, store, false)
+
+	revokedConn := dialTestHub(t, store, hub, revoked.ID)
+	otherConn := dialTestHub(t, store, hub, other.ID)
+
+	hub.CloseSession(revoked.ID)
+
+	closeErr := waitForClose(t, revokedConn, time.Second)
+	if closeErr == nil || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Errorf("revoked connection closed with %v, want code %d", closeErr, websocket.ClosePolicyViolation)
+	}
+	// The user's other session keeps its connection
+	if closeErr := waitForClose(t, otherConn, 50*time.Millisecond); closeErr != nil {
+		t.Errorf("other session's connection closed: %v", closeErr)
+	}
+	if !hub.IsOnline(testUserID) {
+		t.Error("user went offline with a connection still open")
+	}
+}
+
+func TestHubRebindSession(t *testing.T) {
+	store := NewMemorySessionStore(testSessionConfig)
+	hub := NewHub()
+	old := createTestSession(t, store, false)
+	conn := dialTestHub(t, store, hub, old.ID)
+
+	rotated, err := store.Rotate(old.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.RebindSession(old.ID, rotated.ID)
+	if hubHasSession(hub, old.ID) || !hubHasSession(hub, rotated.ID) {
+		t.Fatal("connection was not moved to the rotated ID")
+	}
+
+	// Revoking the old ID no longer reaches the connection; revoking the
+	// session by its current ID does
+	hub.CloseSession(old.ID)
+	hub.SendToUser(testUserID, "test.ping", nil)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		var ev Event
+		if err := conn.ReadJSON(&ev); err != nil {
+			t.Fatalf("closing the rotated-out ID dropped the connection: %v", err)
+		}
+		if ev.Type == "test.ping" {
+			break
+		}
+	}
+	hub.CloseSession(rotated.ID)
+	closeErr := waitForClose(t, conn, time.Second)
+	if closeErr == nil || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Errorf("connection closed with %v, want code %d", closeErr, websocket.ClosePolicyViolation)
+	}
+}
+
+func TestClientSessionAlive(t *testing.T) {
+	cfg := testSessionConfig
+	cfg.IdleTimeout = 20 * time.Millisecond
+	forEachStore(t, cfg, func(t *testing.T, store SessionStore) {
+		sess := createTestSession(t, store, false)
+		c := &Client{hub: NewHub(), sessions: store, SessionID: sess.ID}
+		if !c.sessionAlive() {
+			t.Fatal("sessionAlive = false for a fresh session")
+		}
+
+		// Idling out ends the connection even before the reaper runs
+		time.Sleep(30 * time.Millisecond)
+		if c.sessionAlive() {
+			t.Error("sessionAlive = true after the idle timeout")
+		}
+
+		live := createTestSession(t, store, false)
+		c.SessionID = live.ID
+		if err := store.Delete(live.ID); err != nil {
+			t.Fatal(err)
+		}
+		if c.sessionAlive() {
+			t.Error("sessionAlive = true after the session was deleted")
+		}
+	})
+}
@@ -10,7 +10,7 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-func LoginHandler(db *sql.DB) http.HandlerFunc {
+func LoginHandler(db *sql.DB, sessions SessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Login request received")
 
@@ -33,6 +33,7 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 		email := strings.TrimSpace(r.FormValue("email"))
 		nickname := strings.TrimSpace(r.FormValue("nickname"))
 		password := r.FormValue("password")
+		remember := r.FormValue("remember") != ""
 
 		// Validate form data
 		if loginType != "email" && loginType != "nickname" {
@@ -47,6 +48,7 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		var userID, storedNickname, passwordHash string
+		var isAdmin bool
 		var err error
 
 		if loginType == "email" {
@@ -54,15 +56,15 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 				http.Error(w, "Email required", http.StatusBadRequest)
 				return
 			}
-			err = db.QueryRow(`SELECT id, nickname, password_hash FROM users WHERE email = ?`, email).
-				Scan(&userID, &storedNickname, &passwordHash)
+			err = db.QueryRow(`SELECT id, nickname, password_hash, is_admin FROM users WHERE email = ?`, email).
+				Scan(&userID, &storedNickname, &passwordHash, &isAdmin)
 		} else { // nickname
 			if nickname == "" {
 				http.Error(w, "Nickname required", http.StatusBadRequest)
 				return
 			}
-			err = db.QueryRow(`SELECT id, nickname, password_hash FROM users WHERE nickname = ?`, nickname).
-				Scan(&userID, &storedNickname, &passwordHash)
+			err = db.QueryRow(`SELECT id, nickname, password_hash, is_admin FROM users WHERE nickname = ?`, nickname).
+				Scan(&userID, &storedNickname, &passwordHash, &isAdmin)
 		}
 
 		if err == sql.ErrNoRows {
@@ -83,7 +85,7 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Create session
-		sessionID, err := CreateSession(db, w, userID, storedNickname)
+		sessionID, err := CreateSession(sessions, w, r, userID, storedNickname, isAdmin, remember)
 		if err != nil {
 			log.Printf("Session creation error: %v", err)
 			http.Error(w, "Failed to create session", http.StatusInternalServerError)
@@ -1,13 +1,13 @@
 package handlers
 
 import (
-	"database/sql"
 	"log"
 	"net/http"
 )
 
-// LogoutHandler handles user logout by invalidating the session
-func LogoutHandler(db *sql.DB) http.HandlerFunc {
+// LogoutHandler handles user logout by invalidating the session and closing
+// its WebSocket connections
+func LogoutHandler(sessions SessionStore, hub *Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Logout request received")
 
@@ -16,8 +16,11 @@ func LogoutHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Use existing ClearSession function to handle the logout
-		ClearSession(db, w, r)
+		// Disconnect the session's sockets, then clear it as usual
+		if session := GetSession(sessions, r); session != nil {
+			hub.CloseSession(currentSessionID(session))
+		}
+		ClearSession(sessions, w, r)
 
 		log.Println("User logged out successfully")
 		w.WriteHeader(http.StatusOK)
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"real-time-forum/models"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	// Maximum length of a private message in characters
+	maxMessageLength = 2000
+
+	// Number of messages returned per history page
+	messagePageSize = 10
+)
+
+// historyThrottle keeps rapid scroll-back requests from hammering SQLite
+var historyThrottle = newThrottle(300 * time.Millisecond)
+
+var (
+	errRecipientNotFound = errors.New("recipient not found")
+	errInvalidRecipient  = errors.New("cannot send a message to yourself")
+	errInvalidMessage    = errors.New("message content is required")
+	errMessageTooLong    = errors.New("message is too long")
+)
+
+// ConversationsHandler lists the current user's conversations, most recent first
+func ConversationsHandler(db *sql.DB, sessions SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := GetSession(sessions, r)
+		if session == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT c.id, u.id, u.nickname, c.last_message_at,
+				(SELECT m.content FROM messages m
+				 WHERE m.conversation_id = c.id
+				 ORDER BY m.created_at DESC, m.id DESC LIMIT 1)
+			FROM conversations c
+			JOIN users u ON u.id = CASE WHEN c.user_one_id = ? THEN c.user_two_id ELSE c.user_one_id END
+			WHERE c.user_one_id = ? OR c.user_two_id = ?
+			ORDER BY c.last_message_at DESC`,
+			session.UserID, session.UserID, session.UserID,
+		)
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			http.Error(w, "Failed to fetch conversations", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		conversations := []models.Conversation{}
+		for rows.Next() {
+			var c models.Conversation
+			var lastAt sql.NullTime
+			var lastMessage sql.NullString
+			if err := rows.Scan(&c.ID, &c.OtherUserID, &c.OtherNickname, &lastAt, &lastMessage); err != nil {
+				http.Error(w, "Error scanning conversation", http.StatusInternalServerError)
+				return
+			}
+			if lastAt.Valid {
+				c.LastMessageAt = &lastAt.Time
+			}
+			c.LastMessage = lastMessage.String
+			conversations = append(conversations, c)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conversations)
+	}
+}
+
+// MessagesHandler sends private messages between users
+func MessagesHandler(db *sql.DB, sessions SessionStore, hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := GetSession(sessions, r)
+		if session == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			handleGetMessages(db, w, r, session)
+		case http.MethodPost:
+			handleSendMessage(db, hub, w, r, session)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// handleGetMessages returns one page of a conversation's history, newest first.
+// The conversation is picked by ?conversation_id= or by the other participant's
+// ?user_id=, and ?before= takes the next_cursor of the previous page.
+func handleGetMessages(db *sql.DB, w http.ResponseWriter, r *http.Request, session *models.Session) {
+	if !historyThrottle.Allow(session.UserID) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	query := r.URL.Query()
+	conversationID := query.Get("conversation_id")
+	otherUserID := query.Get("user_id")
+
+	var err error
+	if conversationID == "" && otherUserID != "" {
+		userOne, userTwo := conversationPair(session.UserID, otherUserID)
+		err = db.QueryRow(`
+			SELECT id FROM conversations WHERE user_one_id = ? AND user_two_id = ?`,
+			userOne, userTwo,
+		).Scan(&conversationID)
+		if err == sql.ErrNoRows {
+			// No messages exchanged yet
+			writeMessagePage(w, []models.Message{}, "")
+			return
+		}
+	} else if conversationID != "" {
+		otherUserID, err = conversationPeer(db, conversationID, session.UserID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+	} else {
+		http.Error(w, "conversation_id or user_id is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		http.Error(w, "Failed to fetch messages", http.StatusInternalServerError)
+		return
+	}
+
+	// A message is read once its recipient's read position has reached it
+	myReadAt, iHaveRead := readPosition(db, conversationID, session.UserID)
+	peerReadAt, peerHasRead := readPosition(db, conversationID, otherUserID)
+
+	var rows *sql.Rows
+	if before := query.Get("before"); before != "" {
+		beforeAt, beforeID, ok := decodeCursor(before)
+		if !ok {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		rows, err = db.Query(`
+			SELECT m.id, m.conversation_id, m.sender_id, u.nickname, m.content, m.created_at
+			FROM messages m
+			JOIN users u ON u.id = m.sender_id
+			WHERE m.conversation_id = ?
+				AND (m.created_at < ? OR (m.created_at = ? AND m.id < ?))
+			ORDER BY m.created_at DESC, m.id DESC
+			LIMIT ?`,
+			conversationID, beforeAt, beforeAt, beforeID, messagePageSize+1,
+		)
+	} else {
+		rows, err = db.Query(`
+			SELECT m.id, m.conversation_id, m.sender_id, u.nickname, m.content, m.created_at
+			FROM messages m
+			JOIN users u ON u.id = m.sender_id
+			WHERE m.conversation_id = ?
+			ORDER BY m.created_at DESC, m.id DESC
+			LIMIT ?`,
+			conversationID, messagePageSize+1,
+		)
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		http.Error(w, "Failed to fetch messages", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	messages := []models.Message{}
+	for rows.Next() {
+		var m models.Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.SenderNickname, &m.Content, &m.CreatedAt); err != nil {
+			http.Error(w, "Error scanning message", http.StatusInternalServerError)
+			return
+		}
+		if m.SenderID == session.UserID {
+			m.RecipientID = otherUserID
+			m.Read = peerHasRead && !m.CreatedAt.After(peerReadAt)
+		} else {
+			m.RecipientID = session.UserID
+			m.Read = iHaveRead && !m.CreatedAt.After(myReadAt)
+		}
+		messages = append(messages, m)
+	}
+
+	// The extra row only tells us whether an older page exists
+	nextCursor := ""
+	if len(messages) > messagePageSize {
+		messages = messages[:messagePageSize]
+		last := messages[len(messages)-1]
+		nextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	writeMessagePage(w, messages, nextCursor)
+}
+
+// writeMessagePage writes a page of messages with its continuation cursor
+func writeMessagePage(w http.ResponseWriter, messages []models.Message, nextCursor string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages":    messages,
+		"next_cursor": nextCursor,
+	})
+}
+
+// handleSendMessage stores a message and pushes it to both participants
+func handleSendMessage(db *sql.DB, hub *Hub, w http.ResponseWriter, r *http.Request, session *models.Session) {
+	var req struct {
+		RecipientID string `json:"recipient_id"`
+		Content     string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid message data", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := sendDirectMessage(db, session, req.RecipientID, req.Content)
+	switch {
+	case errors.Is(err, errRecipientNotFound):
+		http.Error(w, "Recipient not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errInvalidRecipient), errors.Is(err, errInvalidMessage), errors.Is(err, errMessageTooLong):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Send message error: %v", err)
+		http.Error(w, "Failed to send message", http.StatusInternalServerError)
+		return
+	}
+
+	// The sender's other tabs need the message as well as the recipient
+	hub.SendToUser(msg.RecipientID, "message.created", msg)
+	hub.SendToUser(msg.SenderID, "message.created", msg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(msg)
+}
+
+// sendDirectMessage validates and stores a message from the session user
+func sendDirectMessage(db *sql.DB, session *models.Session, recipientID, content string) (*models.Message, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, errInvalidMessage
+	}
+	if len([]rune(content)) > maxMessageLength {
+		return nil, errMessageTooLong
+	}
+	if recipientID == "" || recipientID == session.UserID {
+		return nil, errInvalidRecipient
+	}
+
+	var exists int
+	err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE id = ?`, recipientID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, errRecipientNotFound
+	}
+
+	messageID, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	msg := &models.Message{
+		ID:             messageID.String(),
+		SenderID:       session.UserID,
+		SenderNickname: session.Nickname,
+		RecipientID:    recipientID,
+		Content:        content,
+		CreatedAt:      time.Now(),
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	msg.ConversationID, err = getOrCreateConversation(tx, session.UserID, recipientID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO messages (id, conversation_id, sender_id, content, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		msg.ID, msg.ConversationID, msg.SenderID, msg.Content, msg.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE conversations SET last_message_at = ? WHERE id = ?`,
+		msg.CreatedAt, msg.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// conversationPair orders two user IDs the way they are stored in conversations
+func conversationPair(a, b string) (string, string) {
+	if a < b {
+		return a, b
+	}
+	return b, a
+}
+
+// conversationPeer returns the other participant of a conversation, or
+// sql.ErrNoRows if userID is not a participant
+func conversationPeer(db *sql.DB, conversationID, userID string) (string, error) {
+	var peerID string
+	err := db.QueryRow(`
+		SELECT CASE WHEN user_one_id = ? THEN user_two_id ELSE user_one_id END
+		FROM conversations
+		WHERE id = ? AND (user_one_id = ? OR user_two_id = ?)`,
+		userID, conversationID, userID, userID,
+	).Scan(&peerID)
+	return peerID, err
+}
+
+// getOrCreateConversation returns the ID of the conversation between two users
+func getOrCreateConversation(tx *sql.Tx, a, b string) (string, error) {
+	userOne, userTwo := conversationPair(a, b)
+
+	newID, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO conversations (id, user_one_id, user_two_id, created_at)
+		VALUES (?, ?, ?, ?)`,
+		newID.String(), userOne, userTwo, time.Now(),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	err = tx.QueryRow(`
+		SELECT id FROM conversations WHERE user_one_id = ? AND user_two_id = ?`,
+		userOne, userTwo,
+	).Scan(&id)
+	return id, err
+}
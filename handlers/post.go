@@ -3,19 +3,43 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"log"
 
 	"net/http"
 	"real-time-forum/models"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
 )
 
-// PostsHandler handles both GET and POST for posts
-func PostsHandler(db *sql.DB) http.HandlerFunc {
+// Maximum number of categories a single post can be filed under
+const maxPostCategories = 5
+
+// postCategoriesColumn selects a post's category slugs joined by commas in
+// category display order, falling back to the legacy category_id for rows
+// without post_categories
+const postCategoriesColumn = `COALESCE(
+                (SELECT GROUP_CONCAT(pc.category_slug, ',' ORDER BY cat.position, pc.category_slug)
+                    FROM post_categories pc
+                    LEFT JOIN categories cat ON cat.slug = pc.category_slug
+                    WHERE pc.post_id = p.id),
+                p.category_id, '')`
+
+// postInCategory matches posts filed under a category slug (bound twice)
+const postInCategory = `(EXISTS (SELECT 1 FROM post_categories pc
+                    WHERE pc.post_id = p.id AND pc.category_slug = ?)
+                OR (p.category_id = ? AND NOT EXISTS (SELECT 1 FROM post_categories pc
+                    WHERE pc.post_id = p.id)))`
+
+// PostsHandler handles GET and POST for posts, and PUT/DELETE ?id= for
+// the author's own posts
+func PostsHandler(db *sql.DB, sessions SessionStore, hub *Hub) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         // Check session first
-        session := GetSession(db, r)
+        session := GetSession(sessions, r)
         if session == nil || session.ExpiresAt.Before(time.Now()) {
             http.Error(w, "Unauthorized", http.StatusUnauthorized)
             return
@@ -25,72 +49,228 @@ func PostsHandler(db *sql.DB) http.HandlerFunc {
         case "GET":
             handleGetPosts(db, w, r, session)
         case "POST":
-            handleCreatePost(db, w, r, session)
+            handleCreatePost(db, hub, w, r, session)
+        case "PUT":
+            handleUpdatePost(db, hub, w, r, session)
+        case "DELETE":
+            handleDeletePost(db, hub, w, r, session)
         default:
             http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
         }
     }
 }
 
-// handleGetPosts gets posts with optional category filter
+// postSort describes one sort order for the post list. keys are the
+// postListQuery columns the list is ordered by, all in the same direction,
+// ending with id so the order (and therefore the cursor) is stable.
+type postSort struct {
+    keys []string
+    desc bool
+}
+
+var postSorts = map[string]postSort{
+    "newest":          {keys: []string{"created_key", "id"}, desc: true},
+    "oldest":          {keys: []string{"created_key", "id"}, desc: false},
+    "most_liked":      {keys: []string{"likes", "created_key", "id"}, desc: true},
+    "most_commented":  {keys: []string{"comment_count", "created_key", "id"}, desc: true},
+    "recent_activity": {keys: []string{"activity_key", "id"}, desc: true},
+}
+
+const (
+    defaultPostPageSize = 20
+    maxPostPageSize     = 100
+)
+
+// postListQuery selects posts with the computed columns the sorts use.
+// Timestamps are compared as their stored text, which sorts chronologically.
+const postListQuery = `
+    SELECT * FROM (
+        SELECT p.id, p.user_id, ` + postCategoriesColumn + ` AS categories, p.title, p.content,
+            p.likes, p.dislikes, COALESCE(r.reaction, '') AS user_reaction,
+            p.edited_at IS NOT NULL AS edited, p.created_at,
+            CAST(p.created_at AS TEXT) AS created_key,
+            (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL) AS comment_count,
+            CAST(COALESCE((SELECT MAX(c.created_at) FROM comments c WHERE c.post_id = p.id),
+                p.created_at) AS TEXT) AS activity_key
+        FROM posts p
+        LEFT JOIN reactions r
+            ON r.target_type = 'post' AND r.target_id = p.id AND r.user_id = ?
+        WHERE p.deleted_at IS NULL AND %s
+    )`
+
+// handleGetPosts returns one page of posts. Query parameters:
+//   category - only posts filed under this slug ("all" or empty for every post)
+//   sort     - newest (default), oldest, most_liked, most_commented, recent_activity
+//   limit    - page size, up to maxPostPageSize
+//   cursor   - next_cursor from the previous page
 func handleGetPosts(db *sql.DB, w http.ResponseWriter, r *http.Request, session *models.Session) {
-    category := r.URL.Query().Get("category")
+    query := r.URL.Query()
+    category := query.Get("category")
+
+    sortName := query.Get("sort")
+    if sortName == "" {
+        sortName = "newest"
+    }
+    order, ok := postSorts[sortName]
+    if !ok {
+        http.Error(w, "Invalid sort", http.StatusBadRequest)
+        return
+    }
 
-    var rows *sql.Rows
-    var err error
+    limit := defaultPostPageSize
+    if l := query.Get("limit"); l != "" {
+        n, err := strconv.Atoi(l)
+        if err != nil || n < 1 {
+            http.Error(w, "Invalid limit", http.StatusBadRequest)
+            return
+        }
+        limit = min(n, maxPostPageSize)
+    }
 
+    // The current user's own reaction is returned with each post
+    args := []interface{}{session.UserID}
+    filter := "1 = 1"
     if category != "" && category != "all" {
-        // FIXED: Added missing backtick and fixed query syntax
-        rows, err = db.Query(`
-            SELECT id, user_id, category_id, title, content, likes, dislikes, created_at 
-            FROM posts 
-            WHERE category_id = ? 
-            ORDER BY created_at DESC`,
-            category)
-    } else {
-        // FIXED: Added missing backtick
-        rows, err = db.Query(`
-            SELECT id, user_id, category_id, title, content, likes, dislikes, created_at 
-            FROM posts 
-            ORDER BY created_at DESC`)
+        filter = postInCategory
+        args = append(args, category, category)
     }
+    sqlQuery := fmt.Sprintf(postListQuery, filter)
 
+    keyList := strings.Join(order.keys, ", ")
+    op, dir := ">", "ASC"
+    if order.desc {
+        op, dir = "<", "DESC"
+    }
+
+    if cursor := query.Get("cursor"); cursor != "" {
+        keys, ok := decodeKeyCursor(cursor, sortName, len(order.keys))
+        if !ok {
+            http.Error(w, "Invalid cursor", http.StatusBadRequest)
+            return
+        }
+        placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+        sqlQuery += " WHERE (" + keyList + ") " + op + " (" + placeholders + ")"
+        args = append(args, keys...)
+    }
+
+    orderBy := make([]string, len(order.keys))
+    for i, key := range order.keys {
+        orderBy[i] = key + " " + dir
+    }
+    sqlQuery += " ORDER BY " + strings.Join(orderBy, ", ") + " LIMIT ?"
+    args = append(args, limit+1)
+
+    rows, err := db.Query(sqlQuery, args...)
     if err != nil {
+        log.Printf("Database error: %v", err)
         http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
         return
     }
     defer rows.Close()
 
-    var posts []models.Post
+    posts := []models.Post{}
+    var lastKeys []interface{}
+    hasMore := false
     for rows.Next() {
         var p models.Post
-        err := rows.Scan(&p.ID, &p.UserID, &p.CategoryID, &p.Title, &p.Content, &p.LikeCount, &p.DislikeCount, &p.CreatedAt)
+        var categories, createdKey, activityKey string
+        err := rows.Scan(&p.ID, &p.UserID, &categories, &p.Title, &p.Content, &p.LikeCount, &p.DislikeCount,
+            &p.UserReaction, &p.Edited, &p.CreatedAt, &createdKey, &p.CommentCount, &activityKey)
         if err != nil {
             http.Error(w, "Error scanning post", http.StatusInternalServerError)
             return
         }
+        p.Categories = splitCategories(categories)
+
+        // The extra row only tells us whether another page exists
+        if len(posts) == limit {
+            hasMore = true
+            break
+        }
         posts = append(posts, p)
+        lastKeys = postSortKeys(order, p, createdKey, activityKey)
+    }
+
+    nextCursor := ""
+    if hasMore {
+        nextCursor = encodeKeyCursor(sortName, lastKeys...)
     }
 
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(posts)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "posts":       posts,
+        "next_cursor": nextCursor,
+    })
 }
 
-// handleCreatePost creates a new post
-func handleCreatePost(db *sql.DB, w http.ResponseWriter, r *http.Request, session *models.Session) {
-    var post models.Post
-    err := json.NewDecoder(r.Body).Decode(&post)
+// postSortKeys returns the values of order's key columns for a scanned post
+func postSortKeys(order postSort, p models.Post, createdKey, activityKey string) []interface{} {
+    keys := make([]interface{}, 0, len(order.keys))
+    for _, key := range order.keys {
+        switch key {
+        case "created_key":
+            keys = append(keys, createdKey)
+        case "likes":
+            keys = append(keys, p.LikeCount)
+        case "comment_count":
+            keys = append(keys, p.CommentCount)
+        case "activity_key":
+            keys = append(keys, activityKey)
+        case "id":
+            keys = append(keys, p.ID)
+        }
+    }
+    return keys
+}
+
+// handleCreatePost creates a new post and pushes it to the live feed.
+// Categories come from a "categories" array of slugs; the older single
+// "category_id" field is still accepted.
+func handleCreatePost(db *sql.DB, hub *Hub, w http.ResponseWriter, r *http.Request, session *models.Session) {
+    var req struct {
+        Title      string   `json:"title"`
+        Content    string   `json:"content"`
+        Categories []string `json:"categories"`
+        CategoryID string   `json:"category_id"`
+    }
+    err := json.NewDecoder(r.Body).Decode(&req)
     if err != nil {
         http.Error(w, "Invalid post data", http.StatusBadRequest)
         return
     }
 
     // Validation
-    if post.Title == "" || post.Content == "" {
+    if req.Title == "" || req.Content == "" {
         http.Error(w, "Title and content are required", http.StatusBadRequest)
         return
     }
 
+    post := models.Post{
+        Title:      req.Title,
+        Content:    req.Content,
+        Categories: normalizeCategories(append(req.Categories, req.CategoryID)),
+    }
+    if len(post.Categories) == 0 {
+        post.Categories = []string{"general"}
+    }
+    if len(post.Categories) > maxPostCategories {
+        http.Error(w, fmt.Sprintf("A post can have at most %d categories", maxPostCategories), http.StatusBadRequest)
+        return
+    }
+
+    // Only known, active categories may take new posts
+    for _, category := range post.Categories {
+        ok, err := activeCategoryExists(db, category)
+        if err != nil {
+            http.Error(w, "Failed to check category", http.StatusInternalServerError)
+            return
+        }
+        if !ok {
+            http.Error(w, "Unknown category: "+category, http.StatusBadRequest)
+            return
+        }
+    }
+
     postID, err := uuid.NewV4()
     if err != nil {
         http.Error(w, "Failed to generate post ID", http.StatusInternalServerError)
@@ -102,21 +282,308 @@ func handleCreatePost(db *sql.DB, w http.ResponseWriter, r *http.Request, sessio
     // Use user ID from session
     post.UserID = session.UserID
 
-    if post.CategoryID == "" {
-        post.CategoryID = "general"
+    tx, err := db.Begin()
+    if err != nil {
+        http.Error(w, "Failed to save post", http.StatusInternalServerError)
+        return
     }
+    defer tx.Rollback()
 
-    // FIXED: SQL syntax errors - removed extra comma and fixed query structure
-    _, err = db.Exec(`
+    // category_id keeps the first category so older readers still see one
+    _, err = tx.Exec(`
         INSERT INTO posts (id, user_id, category_id, title, content, likes, dislikes, created_at)
         VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-        post.ID, post.UserID, post.CategoryID, post.Title, post.Content, 0, 0, post.CreatedAt,
+        post.ID, post.UserID, post.Categories[0], post.Title, post.Content, 0, 0, post.CreatedAt,
     )
     if err != nil {
         http.Error(w, "Failed to save post", http.StatusInternalServerError)
         return
     }
 
+    for _, category := range post.Categories {
+        _, err = tx.Exec(`
+            INSERT INTO post_categories (post_id, category_slug) VALUES (?, ?)`,
+            post.ID, category,
+        )
+        if err != nil {
+            http.Error(w, "Failed to save post", http.StatusInternalServerError)
+            return
+        }
+    }
+
+    // Read the categories back so they come in the same order as elsewhere
+    var categories string
+    err = tx.QueryRow(`SELECT `+postCategoriesColumn+` FROM posts p WHERE p.id = ?`, post.ID).Scan(&categories)
+    if err != nil {
+        http.Error(w, "Failed to save post", http.StatusInternalServerError)
+        return
+    }
+    post.Categories = splitCategories(categories)
+
+    if err := tx.Commit(); err != nil {
+        http.Error(w, "Failed to save post", http.StatusInternalServerError)
+        return
+    }
+
+    broadcastPost(hub, post)
+
     w.WriteHeader(http.StatusCreated)
     json.NewEncoder(w).Encode(post)
-}
\ No newline at end of file
+}
+
+// handleUpdatePost changes the title and content of the caller's own post,
+// keeping the previous version in post_revisions
+func handleUpdatePost(db *sql.DB, hub *Hub, w http.ResponseWriter, r *http.Request, session *models.Session) {
+    postID := r.URL.Query().Get("id")
+    if postID == "" {
+        http.Error(w, "Post ID is required", http.StatusBadRequest)
+        return
+    }
+
+    var req struct {
+        Title   string `json:"title"`
+        Content string `json:"content"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid post data", http.StatusBadRequest)
+        return
+    }
+    if req.Title == "" || req.Content == "" {
+        http.Error(w, "Title and content are required", http.StatusBadRequest)
+        return
+    }
+
+    tx, err := db.Begin()
+    if err != nil {
+        http.Error(w, "Failed to update post", http.StatusInternalServerError)
+        return
+    }
+    defer tx.Rollback()
+
+    var authorID, title, content string
+    err = tx.QueryRow(`
+        SELECT user_id, title, content FROM posts WHERE id = ? AND deleted_at IS NULL`,
+        postID,
+    ).Scan(&authorID, &title, &content)
+    if err == sql.ErrNoRows {
+        http.Error(w, "Post not found", http.StatusNotFound)
+        return
+    } else if err != nil {
+        log.Printf("Database error: %v", err)
+        http.Error(w, "Failed to update post", http.StatusInternalServerError)
+        return
+    }
+    if authorID != session.UserID {
+        http.Error(w, "You can only edit your own posts", http.StatusForbidden)
+        return
+    }
+
+    // Saving an unchanged post doesn't make a revision
+    if req.Title != title || req.Content != content {
+        revisionID, err := uuid.NewV4()
+        if err != nil {
+            http.Error(w, "Failed to generate revision ID", http.StatusInternalServerError)
+            return
+        }
+        now := time.Now()
+
+        _, err = tx.Exec(`
+            INSERT INTO post_revisions (id, post_id, title, content, editor_id, edited_at)
+            VALUES (?, ?, ?, ?, ?, ?)`,
+            revisionID.String(), postID, title, content, session.UserID, now,
+        )
+        if err != nil {
+            log.Printf("Database error: %v", err)
+            http.Error(w, "Failed to update post", http.StatusInternalServerError)
+            return
+        }
+
+        _, err = tx.Exec(`
+            UPDATE posts SET title = ?, content = ?, edited_at = ? WHERE id = ?`,
+            req.Title, req.Content, now, postID,
+        )
+        if err != nil {
+            log.Printf("Database error: %v", err)
+            http.Error(w, "Failed to update post", http.StatusInternalServerError)
+            return
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        http.Error(w, "Failed to update post", http.StatusInternalServerError)
+        return
+    }
+
+    post, err := getPost(db, postID, session.UserID)
+    if err != nil {
+        log.Printf("Database error: %v", err)
+        http.Error(w, "Failed to fetch post", http.StatusInternalServerError)
+        return
+    }
+
+    // Viewers get the new text without the editor's own reaction
+    update := *post
+    update.UserReaction = ""
+    broadcastToPost(hub, postID, "post.updated", update)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(post)
+}
+
+// handleDeletePost soft-deletes the caller's own post. The row stays so its
+// comments, reactions and revisions still point at something.
+func handleDeletePost(db *sql.DB, hub *Hub, w http.ResponseWriter, r *http.Request, session *models.Session) {
+    postID := r.URL.Query().Get("id")
+    if postID == "" {
+        http.Error(w, "Post ID is required", http.StatusBadRequest)
+        return
+    }
+
+    var authorID string
+    err := db.QueryRow(`
+        SELECT user_id FROM posts WHERE id = ? AND deleted_at IS NULL`,
+        postID,
+    ).Scan(&authorID)
+    if err == sql.ErrNoRows {
+        http.Error(w, "Post not found", http.StatusNotFound)
+        return
+    } else if err != nil {
+        log.Printf("Database error: %v", err)
+        http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+        return
+    }
+    if authorID != session.UserID {
+        http.Error(w, "You can only delete your own posts", http.StatusForbidden)
+        return
+    }
+
+    _, err = db.Exec(`UPDATE posts SET deleted_at = ? WHERE id = ?`, time.Now(), postID)
+    if err != nil {
+        log.Printf("Database error: %v", err)
+        http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+        return
+    }
+
+    hub.Broadcast("post.deleted", map[string]string{"post_id": postID})
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// PostRevisionsHandler lists the earlier versions of a post, newest first
+func PostRevisionsHandler(db *sql.DB, sessions SessionStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        session := GetSession(sessions, r)
+        if session == nil {
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+        if r.Method != http.MethodGet {
+            http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+            return
+        }
+
+        postID := r.URL.Query().Get("id")
+        if postID == "" {
+            http.Error(w, "Post ID is required", http.StatusBadRequest)
+            return
+        }
+
+        var exists int
+        err := db.QueryRow(`
+            SELECT COUNT(*) FROM posts WHERE id = ? AND deleted_at IS NULL`, postID,
+        ).Scan(&exists)
+        if err != nil {
+            http.Error(w, "Failed to fetch post", http.StatusInternalServerError)
+            return
+        }
+        if exists == 0 {
+            http.Error(w, "Post not found", http.StatusNotFound)
+            return
+        }
+
+        rows, err := db.Query(`
+            SELECT pr.id, pr.post_id, pr.title, pr.content, pr.editor_id,
+                COALESCE(u.nickname, ''), pr.edited_at
+            FROM post_revisions pr
+            LEFT JOIN users u ON u.id = pr.editor_id
+            WHERE pr.post_id = ?
+            ORDER BY pr.edited_at DESC, pr.id DESC`,
+            postID,
+        )
+        if err != nil {
+            log.Printf("Database error: %v", err)
+            http.Error(w, "Failed to fetch revisions", http.StatusInternalServerError)
+            return
+        }
+        defer rows.Close()
+
+        revisions := []models.PostRevision{}
+        for rows.Next() {
+            var rev models.PostRevision
+            err := rows.Scan(&rev.ID, &rev.PostID, &rev.Title, &rev.Content, &rev.EditorID,
+                &rev.EditorNickname, &rev.EditedAt)
+            if err != nil {
+                http.Error(w, "Error scanning revision", http.StatusInternalServerError)
+                return
+            }
+            revisions = append(revisions, rev)
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(revisions)
+    }
+}
+
+// getPost loads a single post with userID's reaction to it. A deleted post
+// comes back as a tombstone so its comments can still be shown.
+func getPost(db *sql.DB, postID, userID string) (*models.Post, error) {
+    var post models.Post
+    var categories string
+    err := db.QueryRow(`
+        SELECT p.id, p.user_id, `+postCategoriesColumn+`, p.title, p.content, p.likes, p.dislikes,
+            (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL),
+            COALESCE(r.reaction, ''), p.edited_at IS NOT NULL, p.deleted_at IS NOT NULL, p.created_at
+        FROM posts p
+        LEFT JOIN reactions r
+            ON r.target_type = 'post' AND r.target_id = p.id AND r.user_id = ?
+        WHERE p.id = ?`,
+        userID, postID,
+    ).Scan(
+        &post.ID, &post.UserID, &categories, &post.Title, &post.Content,
+        &post.LikeCount, &post.DislikeCount, &post.CommentCount, &post.UserReaction, &post.Edited, &post.Deleted,
+        &post.CreatedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+    post.Categories = splitCategories(categories)
+
+    if post.Deleted {
+        post.Title = "[deleted]"
+        post.Content = ""
+    }
+    return &post, nil
+}
+
+// normalizeCategories trims, lowercases and de-duplicates category slugs
+func normalizeCategories(categories []string) []string {
+    seen := make(map[string]bool)
+    var result []string
+    for _, category := range categories {
+        category = strings.ToLower(strings.TrimSpace(category))
+        if category == "" || seen[category] {
+            continue
+        }
+        seen[category] = true
+        result = append(result, category)
+    }
+    return result
+}
+
+// splitCategories turns the comma-joined postCategoriesColumn into slugs
+func splitCategories(categories string) []string {
+    if categories == "" {
+        return []string{}
+    }
+    return strings.Split(categories, ",")
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"real-time-forum/models"
+	"time"
+)
+
+// reactionTarget describes where a reaction target keeps its counters and
+// which post it belongs to, so live updates reach the right viewers. live
+// excludes targets that can no longer be reacted to.
+type reactionTarget struct {
+	table        string
+	postIDColumn string
+	live         string
+}
+
+var reactionTargets = map[string]reactionTarget{
+	"post":    {table: "posts", postIDColumn: "id", live: "deleted_at IS NULL"},
+	"comment": {table: "comments", postIDColumn: "post_id", live: "deleted_at IS NULL AND post_id IN (SELECT id FROM posts WHERE deleted_at IS NULL)"},
+}
+
+var errTargetNotFound = errors.New("reaction target not found")
+
+// ReactionsHandler likes or dislikes a post or comment. Sending the same
+// reaction again removes it and sending the other one switches it, so each
+// user has at most one vote per target. New counts are pushed to everyone
+// viewing the post.
+func ReactionsHandler(db *sql.DB, sessions SessionStore, hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := GetSession(sessions, r)
+		if session == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			TargetType string `json:"target_type"`
+			TargetID   string `json:"target_id"`
+			Reaction   string `json:"reaction"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid reaction data", http.StatusBadRequest)
+			return
+		}
+		if _, ok := reactionTargets[req.TargetType]; !ok || req.TargetID == "" {
+			http.Error(w, "Invalid reaction target", http.StatusBadRequest)
+			return
+		}
+		if req.Reaction != "like" && req.Reaction != "dislike" {
+			http.Error(w, "Reaction must be like or dislike", http.StatusBadRequest)
+			return
+		}
+
+		summary, err := toggleReaction(db, session.UserID, req.TargetType, req.TargetID, req.Reaction)
+		if errors.Is(err, errTargetNotFound) {
+			http.Error(w, "Target not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Reaction error: %v", err)
+			http.Error(w, "Failed to save reaction", http.StatusInternalServerError)
+			return
+		}
+
+		// Viewers get the counts only; the reaction itself is the caller's own
+		broadcastToPost(hub, summary.PostID, "reaction.updated", map[string]interface{}{
+			"target_type":   summary.TargetType,
+			"target_id":     summary.TargetID,
+			"post_id":       summary.PostID,
+			"like_count":    summary.LikeCount,
+			"dislike_count": summary.DislikeCount,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summary)
+	}
+}
+
+// toggleReaction applies a like/dislike from userID and recounts the target's
+// counters in the same transaction
+func toggleReaction(db *sql.DB, userID, targetType, targetID, reaction string) (*models.ReactionSummary, error) {
+	target := reactionTargets[targetType]
+	table := target.table
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var postID string
+	err = tx.QueryRow(`SELECT `+target.postIDColumn+` FROM `+table+` WHERE id = ? AND `+target.live, targetID).Scan(&postID)
+	if err == sql.ErrNoRows {
+		return nil, errTargetNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var current string
+	err = tx.QueryRow(`
+		SELECT reaction FROM reactions
+		WHERE user_id = ? AND target_type = ? AND target_id = ?`,
+		userID, targetType, targetID,
+	).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	summary := &models.ReactionSummary{
+		TargetType:   targetType,
+		TargetID:     targetID,
+		PostID:       postID,
+		UserReaction: reaction,
+	}
+
+	switch current {
+	case reaction:
+		// Same reaction again takes the vote back
+		summary.UserReaction = ""
+		_, err = tx.Exec(`
+			DELETE FROM reactions WHERE user_id = ? AND target_type = ? AND target_id = ?`,
+			userID, targetType, targetID)
+	case "":
+		_, err = tx.Exec(`
+			INSERT INTO reactions (user_id, target_type, target_id, reaction, created_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			userID, targetType, targetID, reaction, time.Now())
+	default:
+		_, err = tx.Exec(`
+			UPDATE reactions SET reaction = ?, created_at = ?
+			WHERE user_id = ? AND target_type = ? AND target_id = ?`,
+			reaction, time.Now(), userID, targetType, targetID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Recount rather than increment so the counters can't drift from the votes
+	_, err = tx.Exec(`
+		UPDATE `+table+` SET
+			likes = (SELECT COUNT(*) FROM reactions
+				WHERE target_type = ? AND target_id = ? AND reaction = 'like'),
+			dislikes = (SELECT COUNT(*) FROM reactions
+				WHERE target_type = ? AND target_id = ? AND reaction = 'dislike')
+		WHERE id = ?`,
+		targetType, targetID, targetType, targetID, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`SELECT likes, dislikes FROM `+table+` WHERE id = ?`, targetID).
+		Scan(&summary.LikeCount, &summary.DislikeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
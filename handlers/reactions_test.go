@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// insertTestPost adds a post by the test user
+func insertTestPost(t *testing.T, conn *sql.DB, id string) {
+	t.Helper()
+	_, err := conn.Exec(`
+		INSERT INTO posts (id, user_id, title, content, created_at)
+		VALUES (?, ?, 'Title', 'Content', ?)`,
+		id, testUserID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestToggleReactionRecounts(t *testing.T) {
+	conn := openTestDB(t)
+	insertTestPost(t, conn, "post-1")
+	_, err := conn.Exec(`
+		INSERT INTO users (id, first_name, last_name, nickname, age, gender, email, password_hash)
+		VALUES ('user-2', 'Other', 'User', 'other', 30, 'other', 'other@example.com', 'x')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		userID, reaction string
+		wantLikes        int
+		wantDislikes     int
+		wantReaction     string
+	}{
+		{testUserID, "like", 1, 0, "like"},
+		{"user-2", "dislike", 1, 1, "dislike"},
+		// Switching moves the vote
+		{testUserID, "dislike", 0, 2, "dislike"},
+		// The same reaction again takes it back
+		{testUserID, "dislike", 0, 1, ""},
+	}
+	for _, step := range steps {
+		summary, err := toggleReaction(conn, step.userID, "post", "post-1", step.reaction)
+		if err != nil {
+			t.Fatalf("%s %s: %v", step.userID, step.reaction, err)
+		}
+		if summary.LikeCount != step.wantLikes || summary.DislikeCount != step.wantDislikes || summary.UserReaction != step.wantReaction {
+			t.Errorf("%s %s = %d/%d %q, want %d/%d %q", step.userID, step.reaction,
+				summary.LikeCount, summary.DislikeCount, summary.UserReaction,
+				step.wantLikes, step.wantDislikes, step.wantReaction)
+		}
+	}
+
+	// Counters that drifted are corrected from the votes
+	if _, err := conn.Exec(`UPDATE posts SET likes = 99, dislikes = 99 WHERE id = 'post-1'`); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := toggleReaction(conn, testUserID, "post", "post-1", "like")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var likes, dislikes int
+	if err := conn.QueryRow(`SELECT likes, dislikes FROM posts WHERE id = 'post-1'`).Scan(&likes, &dislikes); err != nil {
+		t.Fatal(err)
+	}
+	if likes != 1 || dislikes != 1 || summary.LikeCount != 1 || summary.DislikeCount != 1 {
+		t.Errorf("after recount stored %d/%d, returned %d/%d; want 1/1",
+			likes, dislikes, summary.LikeCount, summary.DislikeCount)
+	}
+}
+
+func TestToggleReactionMissingTarget(t *testing.T) {
+	conn := openTestDB(t)
+	insertTestPost(t, conn, "deleted")
+	if _, err := conn.Exec(`UPDATE posts SET deleted_at = ? WHERE id = 'deleted'`, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"missing", "deleted"} {
+		if _, err := toggleReaction(conn, testUserID, "post", id, "like"); err != errTargetNotFound {
+			t.Errorf("toggleReaction(%s) error = %v, want errTargetNotFound", id, err)
+		}
+	}
+	var votes int
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM reactions`).Scan(&votes); err != nil {
+		t.Fatal(err)
+	}
+	if votes != 0 {
+		t.Errorf("%d votes recorded for missing targets", votes)
+	}
+}
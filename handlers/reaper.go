@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// ReaperConfig sets how often the Reaper runs each cleanup job; zero
+// disables a job. Offline users' last-seen times are dropped after
+// PresenceTTL.
+type ReaperConfig struct {
+	SessionInterval  time.Duration
+	PresenceInterval time.Duration
+	PresenceTTL      time.Duration
+}
+
+// DefaultReaperConfig is used when nothing else is configured
+var DefaultReaperConfig = ReaperConfig{
+	SessionInterval:  10 * time.Minute,
+	PresenceInterval: 5 * time.Minute,
+	PresenceTTL:      time.Hour,
+}
+
+// Reaper periodically purges data that has outlived its TTL: expired and
+// rotated-out sessions, and presence state of users who went offline.
+// Typing indicators need no sweep; they expire on their own timers.
+type Reaper struct {
+	jobs []reaperJob
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type reaperJob struct {
+	name     string
+	interval time.Duration
+	run      func() (int64, error)
+}
+
+// NewReaper sets up the cleanup jobs for the session store and hub
+func NewReaper(sessions SessionStore, hub *Hub, cfg ReaperConfig) *Reaper {
+	r := &Reaper{stop: make(chan struct{})}
+	r.add("sessions", cfg.SessionInterval, sessions.DeleteExpired)
+	r.add("presence", cfg.PresenceInterval, func() (int64, error) {
+		return hub.pruneLastSeen(cfg.PresenceTTL), nil
+	})
+	return r
+}
+
+func (r *Reaper) add(name string, interval time.Duration, run func() (int64, error)) {
+	if interval > 0 {
+		r.jobs = append(r.jobs, reaperJob{name: name, interval: interval, run: run})
+	}
+}
+
+// Start runs every job once and then on its interval, until Stop
+func (r *Reaper) Start() {
+	for _, job := range r.jobs {
+		r.wg.Add(1)
+		go r.loop(job)
+	}
+}
+
+// Stop ends the jobs, waiting for any that are running to finish
+func (r *Reaper) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+func (r *Reaper) loop(job reaperJob) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+	for {
+		n, err := job.run()
+		if err != nil {
+			log.Printf("Cleanup of %s failed: %v", job.name, err)
+		} else if n > 0 {
+			log.Printf("Cleaned up %d stale %s", n, job.name)
+		}
+
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
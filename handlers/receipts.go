@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"real-time-forum/models"
+	"time"
+)
+
+var errMessageNotFound = errors.New("message not found")
+
+type markReadRequest struct {
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`
+}
+
+// MarkReadHandler marks a conversation read up to a message (or its latest
+// message when message_id is omitted) and notifies the sender
+func MarkReadHandler(db *sql.DB, sessions SessionStore, hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := GetSession(sessions, r)
+		if session == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req markReadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ConversationID == "" {
+			http.Error(w, "conversation_id is required", http.StatusBadRequest)
+			return
+		}
+
+		receipt, peerID, err := markConversationRead(db, req.ConversationID, session.UserID, req.MessageID)
+		switch {
+		case err == sql.ErrNoRows:
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		case errors.Is(err, errMessageNotFound):
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		case err != nil:
+			log.Printf("Mark read error: %v", err)
+			http.Error(w, "Failed to mark conversation read", http.StatusInternalServerError)
+			return
+		}
+
+		pushReceipt(hub, receipt, peerID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(receipt)
+	}
+}
+
+// RegisterReadEvents wires the message.read client event into the hub
+func RegisterReadEvents(db *sql.DB, hub *Hub) {
+	hub.On("message.read", func(c *Client, data json.RawMessage) {
+		var req markReadRequest
+		if err := json.Unmarshal(data, &req); err != nil || req.ConversationID == "" {
+			c.Send("error", map[string]string{"error": "conversation_id is required"})
+			return
+		}
+
+		receipt, peerID, err := markConversationRead(db, req.ConversationID, c.UserID, req.MessageID)
+		switch {
+		case err == sql.ErrNoRows:
+			c.Send("error", map[string]string{"error": "Conversation not found"})
+			return
+		case errors.Is(err, errMessageNotFound):
+			c.Send("error", map[string]string{"error": "Message not found"})
+			return
+		case err != nil:
+			log.Printf("Mark read error: %v", err)
+			return
+		}
+
+		pushReceipt(hub, receipt, peerID)
+	})
+}
+
+// pushReceipt tells the sender their messages were read and clears the
+// unread badge on the reader's other connections
+func pushReceipt(hub *Hub, receipt *models.ReadReceipt, peerID string) {
+	if receipt.LastReadMessageID == "" {
+		return
+	}
+	hub.SendToUser(peerID, "message.read", receipt)
+	hub.SendToUser(receipt.ReaderID, "message.read", receipt)
+}
+
+// markConversationRead moves the reader's position forward to messageID.
+// The position never moves backwards, so late or duplicate events are harmless.
+// last_read_at holds the created_at of the last read message, which is what
+// unread counts and per-message read flags compare against.
+func markConversationRead(db *sql.DB, conversationID, readerID, messageID string) (*models.ReadReceipt, string, error) {
+	peerID, err := conversationPeer(db, conversationID, readerID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var msgAt time.Time
+	if messageID != "" {
+		err = db.QueryRow(`
+			SELECT created_at FROM messages WHERE id = ? AND conversation_id = ?`,
+			messageID, conversationID,
+		).Scan(&msgAt)
+	} else {
+		err = db.QueryRow(`
+			SELECT id, created_at FROM messages
+			WHERE conversation_id = ?
+			ORDER BY created_at DESC, id DESC LIMIT 1`,
+			conversationID,
+		).Scan(&messageID, &msgAt)
+	}
+	if err == sql.ErrNoRows {
+		return nil, "", errMessageNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO conversation_reads (conversation_id, user_id, last_read_message_id, last_read_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(conversation_id, user_id) DO UPDATE SET
+			last_read_message_id = excluded.last_read_message_id,
+			last_read_at = excluded.last_read_at
+		WHERE conversation_reads.last_read_at IS NULL
+			OR excluded.last_read_at > conversation_reads.last_read_at`,
+		conversationID, readerID, messageID, msgAt,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	receipt := &models.ReadReceipt{
+		ConversationID: conversationID,
+		ReaderID:       readerID,
+		ReadAt:         time.Now(),
+	}
+	// Report the stored position, which may be ahead of messageID
+	var lastID sql.NullString
+	err = db.QueryRow(`
+		SELECT last_read_message_id FROM conversation_reads
+		WHERE conversation_id = ? AND user_id = ?`,
+		conversationID, readerID,
+	).Scan(&lastID)
+	if err != nil {
+		return nil, "", err
+	}
+	receipt.LastReadMessageID = lastID.String
+	return receipt, peerID, nil
+}
+
+// readPosition returns the created_at of the last message userID has read
+func readPosition(db *sql.DB, conversationID, userID string) (time.Time, bool) {
+	var lastAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT last_read_at FROM conversation_reads
+		WHERE conversation_id = ? AND user_id = ?`,
+		conversationID, userID,
+	).Scan(&lastAt)
+	if err != nil || !lastAt.Valid {
+		return time.Time{}, false
+	}
+	return lastAt.Time, true
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html"
+	"log"
+	"net/http"
+	"real-time-forum/models"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 50
+	maxSearchTerms        = 10
+
+	// Control characters mark matches in FTS snippets so the text can be
+	// escaped before the markers become <mark> tags
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+// searchPostsQuery matches post titles and content; title hits rank higher
+const searchPostsQuery = `
+	SELECT 'post' AS type, p.id AS post_id, '' AS comment_id, p.title,
+		snippet(posts_fts, -1, char(2), char(3), '…', 24) AS snippet,
+		u.nickname AS author, ` + postCategoriesColumn + ` AS categories, p.created_at,
+		bm25(posts_fts, 0, 5.0, 1.0) AS rank
+	FROM posts_fts
+	JOIN posts p ON p.id = posts_fts.post_id
+	JOIN users u ON u.id = p.user_id
+	WHERE posts_fts MATCH ? AND p.deleted_at IS NULL`
+
+// searchCommentsQuery matches comment bodies, reporting the parent post
+const searchCommentsQuery = `
+	SELECT 'comment' AS type, p.id AS post_id, c.id AS comment_id, p.title,
+		snippet(comments_fts, 1, char(2), char(3), '…', 24) AS snippet,
+		c.nickname AS author, ` + postCategoriesColumn + ` AS categories, c.created_at,
+		bm25(comments_fts) AS rank
+	FROM comments_fts
+	JOIN comments c ON c.id = comments_fts.comment_id
+	JOIN posts p ON p.id = c.post_id
+	WHERE comments_fts MATCH ? AND c.deleted_at IS NULL AND p.deleted_at IS NULL`
+
+// SearchHandler runs a full-text search over posts and comments. Query
+// parameters:
+//
+//	q        - search text; every word must match, the last one as a prefix
+//	type     - posts, comments or all (default)
+//	category - only results from posts filed under this slug
+//	author   - only results written by this nickname
+//	limit    - page size, up to maxSearchPageSize
+//	cursor   - next_cursor from the previous page
+func SearchHandler(db *sql.DB, sessions SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := GetSession(sessions, r)
+		if session == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		match := ftsQuery(query.Get("q"))
+		if match == "" {
+			http.Error(w, "Search text is required", http.StatusBadRequest)
+			return
+		}
+
+		searchType := query.Get("type")
+		if searchType == "" {
+			searchType = "all"
+		}
+		if searchType != "all" && searchType != "posts" && searchType != "comments" {
+			http.Error(w, "Invalid type", http.StatusBadRequest)
+			return
+		}
+
+		limit := defaultSearchPageSize
+		if l := query.Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 1 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxSearchPageSize)
+		}
+
+		// Relevance has no stable key to seek from, so the cursor is an offset
+		offset := int64(0)
+		if cursor := query.Get("cursor"); cursor != "" {
+			keys, ok := decodeKeyCursor(cursor, "search", 1)
+			if !ok {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			offset, ok = keys[0].(int64)
+			if !ok || offset < 0 {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+		}
+
+		category := query.Get("category")
+		author := strings.TrimSpace(query.Get("author"))
+
+		// bm25 scores from posts_fts and comments_fts aren't comparable, so
+		// each source's scores are divided by its best one: the top post and
+		// the top comment both get relevance 1 and the rest fall in (0, 1].
+		// The sources are then merged on relevance, newest first on ties.
+		var parts []string
+		var args []interface{}
+		addPart := func(base, authorColumn string) {
+			part := base
+			args = append(args, match)
+			if category != "" && category != "all" {
+				part += " AND " + postInCategory
+				args = append(args, category, category)
+			}
+			if author != "" {
+				part += " AND " + authorColumn + " = ? COLLATE NOCASE"
+				args = append(args, author)
+			}
+			parts = append(parts, "SELECT *, COALESCE(rank / NULLIF(MIN(rank) OVER (), 0), 1) AS relevance FROM ("+part+")")
+		}
+		if searchType != "comments" {
+			addPart(searchPostsQuery, "u.nickname")
+		}
+		if searchType != "posts" {
+			addPart(searchCommentsQuery, "c.nickname")
+		}
+
+		sqlQuery := "SELECT type, post_id, comment_id, title, snippet, author, categories, created_at FROM (" +
+			strings.Join(parts, " UNION ALL ") +
+			") ORDER BY relevance DESC, created_at DESC, post_id, comment_id LIMIT ? OFFSET ?"
+		args = append(args, limit+1, offset)
+
+		rows, err := db.Query(sqlQuery, args...)
+		if err != nil {
+			if strings.Contains(err.Error(), "no such table") {
+				http.Error(w, "Search is not available", http.StatusServiceUnavailable)
+				return
+			}
+			log.Printf("Database error: %v", err)
+			http.Error(w, "Failed to search", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		results := []models.SearchResult{}
+		hasMore := false
+		for rows.Next() {
+			var res models.SearchResult
+			var categories string
+			err := rows.Scan(&res.Type, &res.PostID, &res.CommentID, &res.Title, &res.Snippet,
+				&res.Author, &categories, &res.CreatedAt)
+			if err != nil {
+				http.Error(w, "Error scanning search result", http.StatusInternalServerError)
+				return
+			}
+
+			// The extra row only tells us whether another page exists
+			if len(results) == limit {
+				hasMore = true
+				break
+			}
+			res.Categories = splitCategories(categories)
+			res.Snippet = highlightSnippet(res.Snippet)
+			results = append(results, res)
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Database error: %v", err)
+			http.Error(w, "Failed to search", http.StatusInternalServerError)
+			return
+		}
+
+		nextCursor := ""
+		if hasMore {
+			nextCursor = encodeKeyCursor("search", offset+int64(limit))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results":     results,
+			"next_cursor": nextCursor,
+		})
+	}
+}
+
+// ftsQuery turns free text into an FTS5 query in which every word must
+// match and the last word may be a prefix. Words are quoted so operators
+// and punctuation in user input are searched for literally. Words with no
+// letters or digits are dropped, since the tokenizer would leave them empty.
+func ftsQuery(text string) string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		word = strings.ReplaceAll(word, `"`, "")
+		if strings.IndexFunc(word, isWordChar) < 0 {
+			continue
+		}
+		terms = append(terms, `"`+word+`"`)
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	terms[len(terms)-1] += "*"
+	return strings.Join(terms, " ")
+}
+
+// isWordChar reports whether r can be part of an indexed token
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// highlightSnippet escapes a snippet and turns the match markers into <mark>
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, snippetOpen, "<mark>")
+	return strings.ReplaceAll(snippet, snippetClose, "</mark>")
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFTSQuery(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"empty", "", ""},
+		{"blank", "   ", ""},
+		{"single word", "golang", `"golang"*`},
+		{"every word required", "hello world", `"hello" "world"*`},
+		{"operators are literal", "go OR rust", `"go" "OR" "rust"*`},
+		{"quotes stripped", `say "hi"`, `"say" "hi"*`},
+		{"punctuation kept inside words", "c++ node.js", `"c++" "node.js"*`},
+		{"trailing wildcard dropped", "golang *", `"golang"*`},
+		{"trailing dash dropped", "hello -", `"hello"*`},
+		{"punctuation only", `- * "" ...`, ""},
+		{"unicode letters", "café 東京", `"café" "東京"*`},
+		{"digits", "2024", `"2024"*`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ftsQuery(tt.text); got != tt.want {
+				t.Errorf("ftsQuery(%q) = %s, want %s", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFTSQueryLimitsTerms(t *testing.T) {
+	got := ftsQuery(strings.Repeat("word ", maxSearchTerms+5))
+	if n := strings.Count(got, `"word"`); n != maxSearchTerms {
+		t.Errorf("ftsQuery kept %d terms, want %d", n, maxSearchTerms)
+	}
+}
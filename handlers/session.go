@@ -1,90 +1,105 @@
 package handlers
 
 import (
-	"database/sql"
+	"log"
+	"net"
 	"net/http"
 	"real-time-forum/models"
-	"time"
-
-	"github.com/gofrs/uuid"
 )
 
-// CreateSession inserts a new session and sets a cookie
-func CreateSession(db *sql.DB, w http.ResponseWriter, userID, nickname string) (string, error) {
-	sessionID, err := uuid.NewV4()
-	if err != nil {
-		return "", err
+// Name of the cookie carrying the session ID
+const sessionCookieName = "session_id"
+
+// CreateSession starts a session for the device making the request and
+// sets its cookie. Remember-me sessions outlive the browser; others end
+// with it. Any session the request already had is ended, so a login always
+// gets a fresh ID. The session's CSRF token is handed to the page too.
+func CreateSession(sessions SessionStore, w http.ResponseWriter, r *http.Request, userID, nickname string, isAdmin, remember bool) (string, error) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if err := sessions.Delete(cookie.Value); err != nil {
+			log.Printf("Session delete error: %v", err)
+		}
 	}
-	sid := sessionID.String()
-	expiresAt := time.Now().Add(15 * time.Minute)
-	lastActive := time.Now()
 
-	_, err = db.Exec(`
-		INSERT INTO sessions (id, user_id, nickname, expires_at, last_active)
-		VALUES (?, ?, ?, ?, ?)`,
-		sid, userID, nickname, expiresAt, lastActive,
-	)
-	if err != nil {
+	sess := &models.Session{
+		UserID:    userID,
+		Nickname:  nickname,
+		IsAdmin:   isAdmin,
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+		Remember:  remember,
+	}
+	if err := sessions.Create(sess); err != nil {
 		return "", err
 	}
 
-	// Use consistent cookie name "session_id"
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sid,
+	setSessionCookie(w, sess)
+	setCSRFCookie(w, sess.CSRFToken)
+	return sess.ID, nil
+}
+
+// setSessionCookie points the session cookie at sess. The cookie lasts as
+// long as the session can, so it never outlives it.
+func setSessionCookie(w http.ResponseWriter, sess *models.Session) {
+	cookie := &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    sess.ID,
 		Path:     "/",
 		HttpOnly: true,
-		MaxAge:   86400, // 1 day
-	})
-
-	return sid, nil
+		SameSite: http.SameSiteLaxMode,
+	}
+	if sess.Remember {
+		cookie.Expires = sess.EndsAt
+	}
+	http.SetCookie(w, cookie)
 }
 
-
-
-func GetSession(db *sql.DB, r *http.Request) *models.Session {
-	cookie, err := r.Cookie("session")
+// GetSession looks up the session named by the session cookie
+func GetSession(sessions SessionStore, r *http.Request) *models.Session {
+	cookie, err := r.Cookie(sessionCookieName)
 	if err != nil {
 		return nil
 	}
 
-	var sess models.Session
-	err = db.QueryRow(`
-		SELECT user_id, nickname, expires_at FROM sessions WHERE id = ?`,
-		cookie.Value,
-	).Scan(&sess.UserID, &sess.Nickname, &sess.ExpiresAt)
-
-	if err != nil || sess.ExpiresAt.Before(time.Now()) {
+	sess, err := sessions.Get(cookie.Value)
+	if err != nil {
+		if err != ErrSessionNotFound {
+			log.Printf("Session lookup error: %v", err)
+		}
 		return nil
 	}
-
-	// Optionally refresh session expiry on activity
-	_, _ = db.Exec(`
-		UPDATE sessions SET last_active = ?, expires_at = ? WHERE id = ?`,
-		time.Now(), time.Now().Add(15*time.Minute), cookie.Value,
-	)
-
-	// Optionally refresh session expiry on activity
-	_, _ = db.Exec(`
-		UPDATE sessions SET last_active = ?, expires_at = ? WHERE id = ?`,
-		time.Now(), time.Now().Add(15*time.Minute), cookie.Value,
-	)
-
-	return &models.Session{}
+	return sess
 }
 
-// ClearSession deletes session from DB and clears cookie
-func ClearSession(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session_id")
-	if err == nil {
-		db.Exec(`DELETE FROM sessions WHERE id = ?`, cookie.Value)
+// ClearSession ends the request's session and clears the cookie. The page
+// gets a logged-out CSRF token in place of the session's.
+func ClearSession(sessions SessionStore, w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if err := sessions.Delete(cookie.Value); err != nil {
+			log.Printf("Session delete error: %v", err)
+		}
 	}
 
 	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
+		Name:     sessionCookieName,
 		Value:    "",
 		Path:     "/",
 		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 		MaxAge:   -1,
 	})
-}
\ No newline at end of file
+
+	// Back to a logged-out token
+	if token, err := newCSRFToken(); err == nil {
+		setCSRFCookie(w, token)
+	}
+}
+
+// clientIP returns the address the request came from, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,497 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"real-time-forum/models"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// SessionConfig sets how long sessions last. Ordinary sessions expire after
+// IdleTimeout without a request and at most Lifetime after login;
+// remember-me sessions only end after RememberLifetime. Sessions get a new
+// ID every RotateInterval, or never when it is zero.
+type SessionConfig struct {
+	IdleTimeout      time.Duration
+	Lifetime         time.Duration
+	RememberLifetime time.Duration
+	RotateInterval   time.Duration
+}
+
+// DefaultSessionConfig is used when nothing else is configured
+var DefaultSessionConfig = SessionConfig{
+	IdleTimeout:      15 * time.Minute,
+	Lifetime:         24 * time.Hour,
+	RememberLifetime: 30 * 24 * time.Hour,
+	RotateInterval:   time.Hour,
+}
+
+// A rotated-out ID keeps working this long so requests already in flight
+// with the old cookie don't fail
+const sessionRotationGrace = time.Minute
+
+// ErrSessionNotFound is returned for unknown and expired sessions
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore keeps login sessions. Create fills in the ID and timestamps
+// of a session describing the user and device. Get and Touch treat expired
+// sessions as missing. IsAdmin given to Create is the user's role at login;
+// a store backed by the users table may read it live instead.
+//
+// Touch records activity and returns the session. When the session is due
+// for rotation it first moves it to a new ID, which the returned session
+// carries. Rotate does that unconditionally. The old ID stays valid for
+// sessionRotationGrace with ReplacedBy set, and deleting the new ID ends it
+// too. DeleteExpired purges sessions that have expired, returning how many.
+type SessionStore interface {
+	Create(sess *models.Session) error
+	Get(id string) (*models.Session, error)
+	Touch(id string) (*models.Session, error)
+	Rotate(id string) (*models.Session, error)
+	Delete(id string) error
+	DeleteAllForUser(userID string) error
+	ListForUser(userID string) ([]models.Session, error)
+	DeleteExpired() (int64, error)
+}
+
+// start gives a new session a random ID and CSRF token, its lifetime and
+// its first expiry
+func (c SessionConfig) start(sess *models.Session) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	token, err := newCSRFToken()
+	if err != nil {
+		return err
+	}
+	sess.CSRFToken = token
+	now := time.Now()
+	sess.ID = id.String()
+	sess.CreatedAt = now
+	sess.LastActive = now
+	sess.RotatedAt = now
+	if sess.Remember {
+		sess.EndsAt = now.Add(c.RememberLifetime)
+	} else {
+		sess.EndsAt = now.Add(c.Lifetime)
+	}
+	sess.ExpiresAt = c.expiry(sess, now)
+	return nil
+}
+
+// expiry returns when sess expires if it is used at now
+func (c SessionConfig) expiry(sess *models.Session, now time.Time) time.Time {
+	if sess.Remember {
+		return sess.EndsAt
+	}
+	expires := now.Add(c.IdleTimeout)
+	if expires.After(sess.EndsAt) {
+		return sess.EndsAt
+	}
+	return expires
+}
+
+// dueForRotation reports whether sess should get a new ID: periodically,
+// and whenever the user's role changed since the ID was issued
+func (c SessionConfig) dueForRotation(sess *models.Session, now time.Time) bool {
+	if sess.ReplacedBy != "" {
+		return false
+	}
+	if sess.RoleChanged {
+		return true
+	}
+	return c.RotateInterval > 0 && now.Sub(sess.RotatedAt) >= c.RotateInterval
+}
+
+// rotate copies old under a new ID. The CSRF token stays, so pages loaded
+// before the rotation keep working.
+func (c SessionConfig) rotate(old *models.Session) (*models.Session, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	sess := *old
+	sess.ID = id.String()
+	sess.LastActive = now
+	sess.RotatedAt = now
+	sess.RoleChanged = false
+	sess.ExpiresAt = c.expiry(&sess, now)
+	return &sess, nil
+}
+
+// graceExpiry returns the expiry of a rotated-out session
+func graceExpiry(old *models.Session) time.Time {
+	expires := time.Now().Add(sessionRotationGrace)
+	if old.ExpiresAt.Before(expires) {
+		return old.ExpiresAt
+	}
+	return expires
+}
+
+// SQLiteSessionStore keeps sessions in the sessions table
+type SQLiteSessionStore struct {
+	db  *sql.DB
+	cfg SessionConfig
+}
+
+func NewSQLiteSessionStore(db *sql.DB, cfg SessionConfig) *SQLiteSessionStore {
+	return &SQLiteSessionStore{db: db, cfg: cfg}
+}
+
+// insertSession is the statement Create and Rotate store sessions with
+const insertSession = `
+	INSERT INTO sessions (id, user_id, nickname, created_at, expires_at, last_active, user_agent, ip,
+		remember, ends_at, rotated_at, is_admin, csrf_token)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+func insertSessionArgs(sess *models.Session) []interface{} {
+	return []interface{}{
+		sess.ID, sess.UserID, sess.Nickname, sess.CreatedAt, sess.ExpiresAt, sess.LastActive,
+		sess.UserAgent, sess.IP, sess.Remember, sess.EndsAt, sess.RotatedAt, sess.IsAdmin,
+		sess.CSRFToken,
+	}
+}
+
+// Create starts a session
+func (s *SQLiteSessionStore) Create(sess *models.Session) error {
+	if err := s.cfg.start(sess); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(insertSession, insertSessionArgs(sess)...)
+	return err
+}
+
+// sessionColumns selects a models.Session; is_admin comes from users so
+// role changes apply to existing sessions, and is compared with the role
+// recorded when the ID was issued
+const sessionColumns = `
+	s.id, s.user_id, s.nickname, u.is_admin, s.created_at, s.last_active, s.expires_at,
+	COALESCE(s.user_agent, ''), COALESCE(s.ip, ''), s.remember, s.ends_at, s.rotated_at,
+	s.is_admin, COALESCE(s.replaced_by, ''), COALESCE(s.csrf_token, '')`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*models.Session, error) {
+	var sess models.Session
+	var createdAt, endsAt, rotatedAt sql.NullTime
+	var issuedAdmin bool
+	err := row.Scan(&sess.ID, &sess.UserID, &sess.Nickname, &sess.IsAdmin,
+		&createdAt, &sess.LastActive, &sess.ExpiresAt, &sess.UserAgent, &sess.IP,
+		&sess.Remember, &endsAt, &rotatedAt, &issuedAdmin, &sess.ReplacedBy, &sess.CSRFToken)
+	if err != nil {
+		return nil, err
+	}
+	sess.RoleChanged = sess.IsAdmin != issuedAdmin
+
+	// Sessions from before these columns were recorded fall back to
+	// last_active and, having no lifetime, end at their current expiry
+	sess.CreatedAt = sess.LastActive
+	if createdAt.Valid {
+		sess.CreatedAt = createdAt.Time
+	}
+	sess.EndsAt = sess.ExpiresAt
+	if endsAt.Valid {
+		sess.EndsAt = endsAt.Time
+	}
+	sess.RotatedAt = sess.CreatedAt
+	if rotatedAt.Valid {
+		sess.RotatedAt = rotatedAt.Time
+	}
+	return &sess, nil
+}
+
+// Get loads a live session
+func (s *SQLiteSessionStore) Get(id string) (*models.Session, error) {
+	sess, err := scanSession(s.db.QueryRow(`
+		SELECT `+sessionColumns+`
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = ?`,
+		id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if sess.ExpiresAt.Before(time.Now()) {
+		return nil, ErrSessionNotFound
+	}
+	return sess, nil
+}
+
+// Touch records activity and pushes the expiry back, rotating the ID when
+// it is due
+func (s *SQLiteSessionStore) Touch(id string) (*models.Session, error) {
+	sess, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	// A rotated-out ID only lives out its grace period
+	if sess.ReplacedBy != "" {
+		return sess, nil
+	}
+
+	now := time.Now()
+	if s.cfg.dueForRotation(sess, now) {
+		return s.rotate(sess)
+	}
+
+	sess.LastActive = now
+	sess.ExpiresAt = s.cfg.expiry(sess, now)
+	_, err = s.db.Exec(`UPDATE sessions SET last_active = ?, expires_at = ? WHERE id = ?`,
+		sess.LastActive, sess.ExpiresAt, id)
+	if err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Rotate moves a session to a new ID
+func (s *SQLiteSessionStore) Rotate(id string) (*models.Session, error) {
+	old, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if old.ReplacedBy != "" {
+		return s.Get(old.ReplacedBy)
+	}
+	return s.rotate(old)
+}
+
+func (s *SQLiteSessionStore) rotate(old *models.Session) (*models.Session, error) {
+	sess, err := s.cfg.rotate(old)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Only one concurrent request gets to rotate a session; the others
+	// pick up its new ID
+	result, err := tx.Exec(`
+		UPDATE sessions SET replaced_by = ?, expires_at = ?
+		WHERE id = ? AND replaced_by IS NULL`,
+		sess.ID, graceExpiry(old), old.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return s.Rotate(old.ID)
+	}
+	if _, err := tx.Exec(insertSession, insertSessionArgs(sess)...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Delete ends a session, along with any ID it replaced
+func (s *SQLiteSessionStore) Delete(id string) error {
+	_, err := s.db.Exec(`DELETE FROM sessions WHERE id = ? OR replaced_by = ?`, id, id)
+	return err
+}
+
+// DeleteAllForUser ends every session of a user
+func (s *SQLiteSessionStore) DeleteAllForUser(userID string) error {
+	_, err := s.db.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+	return err
+}
+
+// ListForUser returns a user's live sessions, most recently active first.
+// Rotated-out IDs are left out.
+func (s *SQLiteSessionStore) ListForUser(userID string) ([]models.Session, error) {
+	rows, err := s.db.Query(`
+		SELECT `+sessionColumns+`
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.user_id = ? AND s.expires_at > ? AND s.replaced_by IS NULL
+		ORDER BY s.last_active DESC`,
+		userID, time.Now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *sess)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteExpired purges expired sessions
+func (s *SQLiteSessionStore) DeleteExpired() (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM sessions WHERE expires_at <= ?`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// MemorySessionStore keeps sessions in memory. It is meant for tests and
+// loses every session on restart. Roles are not re-read, so sessions only
+// rotate periodically.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	cfg      SessionConfig
+	sessions map[string]models.Session
+}
+
+func NewMemorySessionStore(cfg SessionConfig) *MemorySessionStore {
+	return &MemorySessionStore{cfg: cfg, sessions: make(map[string]models.Session)}
+}
+
+// Create starts a session
+func (s *MemorySessionStore) Create(sess *models.Session) error {
+	if err := s.cfg.start(sess); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sess.ID] = *sess
+	return nil
+}
+
+// Get loads a live session
+func (s *MemorySessionStore) Get(id string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(id)
+}
+
+func (s *MemorySessionStore) get(id string) (*models.Session, error) {
+	sess, ok := s.sessions[id]
+	if !ok || sess.ExpiresAt.Before(time.Now()) {
+		return nil, ErrSessionNotFound
+	}
+	return &sess, nil
+}
+
+// Touch records activity and pushes the expiry back, rotating the ID when
+// it is due
+func (s *MemorySessionStore) Touch(id string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if sess.ReplacedBy != "" {
+		return sess, nil
+	}
+
+	now := time.Now()
+	if s.cfg.dueForRotation(sess, now) {
+		return s.rotate(sess)
+	}
+	sess.LastActive = now
+	sess.ExpiresAt = s.cfg.expiry(sess, now)
+	s.sessions[id] = *sess
+	return sess, nil
+}
+
+// Rotate moves a session to a new ID
+func (s *MemorySessionStore) Rotate(id string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if old.ReplacedBy != "" {
+		return s.get(old.ReplacedBy)
+	}
+	return s.rotate(old)
+}
+
+func (s *MemorySessionStore) rotate(old *models.Session) (*models.Session, error) {
+	sess, err := s.cfg.rotate(old)
+	if err != nil {
+		return nil, err
+	}
+	old.ReplacedBy = sess.ID
+	old.ExpiresAt = graceExpiry(old)
+	s.sessions[old.ID] = *old
+	s.sessions[sess.ID] = *sess
+	return sess, nil
+}
+
+// Delete ends a session, along with any ID it replaced
+func (s *MemorySessionStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sid, sess := range s.sessions {
+		if sid == id || sess.ReplacedBy == id {
+			delete(s.sessions, sid)
+		}
+	}
+	return nil
+}
+
+// DeleteAllForUser ends every session of a user
+func (s *MemorySessionStore) DeleteAllForUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, sess := range s.sessions {
+		if sess.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+// ListForUser returns a user's live sessions, most recently active first.
+// Rotated-out IDs are left out.
+func (s *MemorySessionStore) ListForUser(userID string) ([]models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	sessions := []models.Session{}
+	for _, sess := range s.sessions {
+		if sess.UserID == userID && sess.ExpiresAt.After(now) && sess.ReplacedBy == "" {
+			sessions = append(sessions, sess)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastActive.After(sessions[j].LastActive)
+	})
+	return sessions, nil
+}
+
+// DeleteExpired purges expired sessions
+func (s *MemorySessionStore) DeleteExpired() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var n int64
+	for id, sess := range s.sessions {
+		if !sess.ExpiresAt.After(now) {
+			delete(s.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"database/sql"
+	"path/filepath"
+	"real-time-forum/db"
+	"real-time-forum/models"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const testUserID = "user-1"
+
+var testSessionConfig = SessionConfig{
+	IdleTimeout:      time.Hour,
+	Lifetime:         24 * time.Hour,
+	RememberLifetime: 30 * 24 * time.Hour,
+}
+
+// openTestDB creates a database with the forum schema and one user
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	db.InitializeSchema(conn)
+	_, err = conn.Exec(`
+		INSERT INTO users (id, first_name, last_name, nickname, age, gender, email, password_hash)
+		VALUES (?, 'Test', 'User', 'tester', 30, 'other', 'tester@example.com', 'x')`,
+		testUserID,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// forEachStore runs fn against every SessionStore implementation
+func forEachStore(t *testing.T, cfg SessionConfig, fn func(t *testing.T, store SessionStore)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewMemorySessionStore(cfg))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		fn(t, NewSQLiteSessionStore(openTestDB(t), cfg))
+	})
+}
+
+func createTestSession(t *testing.T, store SessionStore, remember bool) *models.Session {
+	t.Helper()
+	sess := &models.Session{UserID: testUserID, Nickname: "tester", Remember: remember}
+	if err := store.Create(sess); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return sess
+}
+
+func TestSessionStoreCreateAndGet(t *testing.T) {
+	forEachStore(t, testSessionConfig, func(t *testing.T, store SessionStore) {
+		sess := createTestSession(t, store, false)
+		if sess.ID == "" || sess.CSRFToken == "" {
+			t.Fatalf("Create left ID %q, CSRF token %q", sess.ID, sess.CSRFToken)
+		}
+
+		got, err := store.Get(sess.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.UserID != testUserID || got.CSRFToken != sess.CSRFToken || got.Remember {
+			t.Errorf("Get = %+v, want the created session", got)
+		}
+		if !got.ExpiresAt.Equal(sess.ExpiresAt) || !got.EndsAt.Equal(sess.EndsAt) {
+			t.Errorf("Get expiry %v/%v, want %v/%v", got.ExpiresAt, got.EndsAt, sess.ExpiresAt, sess.EndsAt)
+		}
+
+		if _, err := store.Get("missing"); err != ErrSessionNotFound {
+			t.Errorf("Get(missing) error = %v, want ErrSessionNotFound", err)
+		}
+	})
+}
+
+func TestSessionStoreTouchExtendsExpiry(t *testing.T) {
+	forEachStore(t, testSessionConfig, func(t *testing.T, store SessionStore) {
+		sess := createTestSession(t, store, false)
+
+		time.Sleep(5 * time.Millisecond)
+		touched, err := store.Touch(sess.ID)
+		if err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+		if touched.ID != sess.ID {
+			t.Errorf("Touch rotated the session with rotation disabled")
+		}
+		if !touched.ExpiresAt.After(sess.ExpiresAt) {
+			t.Errorf("Touch expiry %v, want after %v", touched.ExpiresAt, sess.ExpiresAt)
+		}
+
+		got, err := store.Get(sess.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if !got.ExpiresAt.Equal(touched.ExpiresAt) {
+			t.Errorf("stored expiry %v, want %v", got.ExpiresAt, touched.ExpiresAt)
+		}
+	})
+}
+
+func TestSessionStoreExpiredSessions(t *testing.T) {
+	cfg := testSessionConfig
+	cfg.IdleTimeout = time.Millisecond
+	forEachStore(t, cfg, func(t *testing.T, store SessionStore) {
+		expired := createTestSession(t, store, false)
+		remembered := createTestSession(t, store, true)
+		time.Sleep(10 * time.Millisecond)
+
+		if _, err := store.Get(expired.ID); err != ErrSessionNotFound {
+			t.Errorf("Get(expired) error = %v, want ErrSessionNotFound", err)
+		}
+		if _, err := store.Touch(expired.ID); err != ErrSessionNotFound {
+			t.Errorf("Touch(expired) error = %v, want ErrSessionNotFound", err)
+		}
+
+		n, err := store.DeleteExpired()
+		if err != nil {
+			t.Fatalf("DeleteExpired: %v", err)
+		}
+		if n != 1 {
+			t.Errorf("DeleteExpired removed %d sessions, want 1", n)
+		}
+		// Remember-me sessions don't idle out
+		if _, err := store.Get(remembered.ID); err != nil {
+			t.Errorf("Get(remembered): %v", err)
+		}
+	})
+}
+
+func TestSessionStoreRotate(t *testing.T) {
+	forEachStore(t, testSessionConfig, func(t *testing.T, store SessionStore) {
+		old := createTestSession(t, store, false)
+
+		rotated, err := store.Rotate(old.ID)
+		if err != nil {
+			t.Fatalf("Rotate: %v", err)
+		}
+		if rotated.ID == old.ID {
+			t.Fatal("Rotate kept the ID")
+		}
+		if !rotated.CreatedAt.Equal(old.CreatedAt) || rotated.CSRFToken != old.CSRFToken {
+			t.Errorf("Rotate changed the session: %+v, was %+v", rotated, old)
+		}
+
+		// The old ID lives out its grace period pointing at the new one
+		grace, err := store.Get(old.ID)
+		if err != nil {
+			t.Fatalf("Get(old): %v", err)
+		}
+		if grace.ReplacedBy != rotated.ID {
+			t.Errorf("old ReplacedBy = %q, want %q", grace.ReplacedBy, rotated.ID)
+		}
+		if grace.ExpiresAt.After(time.Now().Add(sessionRotationGrace)) {
+			t.Errorf("old expiry %v is past the grace period", grace.ExpiresAt)
+		}
+		touched, err := store.Touch(old.ID)
+		if err != nil || touched.ID != old.ID || !touched.ExpiresAt.Equal(grace.ExpiresAt) {
+			t.Errorf("Touch(old) = %+v, %v; want it unchanged", touched, err)
+		}
+
+		// Rotating the old ID again hands back its replacement
+		again, err := store.Rotate(old.ID)
+		if err != nil || again.ID != rotated.ID {
+			t.Errorf("Rotate(old) again = %+v, %v; want %q", again, err, rotated.ID)
+		}
+
+		list, err := store.ListForUser(testUserID)
+		if err != nil {
+			t.Fatalf("ListForUser: %v", err)
+		}
+		if len(list) != 1 || list[0].ID != rotated.ID {
+			t.Errorf("ListForUser = %+v, want only %q", list, rotated.ID)
+		}
+
+		// Ending the session ends the rotated-out ID too
+		if err := store.Delete(rotated.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := store.Get(old.ID); err != ErrSessionNotFound {
+			t.Errorf("Get(old) after Delete error = %v, want ErrSessionNotFound", err)
+		}
+	})
+}
+
+func TestSessionStoreTouchRotatesWhenDue(t *testing.T) {
+	cfg := testSessionConfig
+	cfg.RotateInterval = time.Nanosecond
+	forEachStore(t, cfg, func(t *testing.T, store SessionStore) {
+		sess := createTestSession(t, store, false)
+		time.Sleep(time.Millisecond)
+
+		touched, err := store.Touch(sess.ID)
+		if err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+		if touched.ID == sess.ID {
+			t.Error("Touch did not rotate a session that was due")
+		}
+	})
+}
+
+func TestSQLiteSessionStoreRotatesOnRoleChange(t *testing.T) {
+	conn := openTestDB(t)
+	store := NewSQLiteSessionStore(conn, testSessionConfig)
+	sess := createTestSession(t, store, false)
+
+	if _, err := conn.Exec(`UPDATE users SET is_admin = 1 WHERE id = ?`, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	touched, err := store.Touch(sess.ID)
+	if err != nil {
+		t.Fatalf("Touch: %v", err)
+	}
+	if touched.ID == sess.ID || !touched.IsAdmin {
+		t.Fatalf("Touch = %+v, want a new admin session", touched)
+	}
+
+	// The new ID was issued with the new role
+	again, err := store.Touch(touched.ID)
+	if err != nil || again.ID != touched.ID || again.RoleChanged {
+		t.Errorf("Touch(new) = %+v, %v; want no further rotation", again, err)
+	}
+}
+
+func TestSQLiteSessionStoreConcurrentRotation(t *testing.T) {
+	store := NewSQLiteSessionStore(openTestDB(t), testSessionConfig)
+	old := createTestSession(t, store, false)
+
+	// Two requests loaded the session before either rotated it
+	stale, err := store.Get(old.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := store.rotate(stale)
+	if err != nil {
+		t.Fatalf("first rotate: %v", err)
+	}
+	second, err := store.rotate(stale)
+	if err != nil {
+		t.Fatalf("second rotate: %v", err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("second rotate = %q, want the first's %q", second.ID, first.ID)
+	}
+
+	list, err := store.ListForUser(testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Errorf("ListForUser returned %d sessions, want 1", len(list))
+	}
+}
+
+func TestSessionConfigExpiry(t *testing.T) {
+	cfg := SessionConfig{IdleTimeout: time.Hour, Lifetime: 90 * time.Minute, RememberLifetime: 48 * time.Hour}
+	now := time.Now()
+
+	sess := &models.Session{}
+	if err := cfg.start(sess); err != nil {
+		t.Fatal(err)
+	}
+	if d := sess.EndsAt.Sub(sess.CreatedAt); d != cfg.Lifetime {
+		t.Errorf("lifetime %v, want %v", d, cfg.Lifetime)
+	}
+	if got, want := cfg.expiry(sess, now), now.Add(cfg.IdleTimeout); !got.Equal(want) {
+		t.Errorf("expiry = %v, want %v", got, want)
+	}
+	// Idle extensions stop at the end of the lifetime
+	later := now.Add(80 * time.Minute)
+	if got := cfg.expiry(sess, later); !got.Equal(sess.EndsAt) {
+		t.Errorf("expiry near the end = %v, want %v", got, sess.EndsAt)
+	}
+
+	remembered := &models.Session{Remember: true}
+	if err := cfg.start(remembered); err != nil {
+		t.Fatal(err)
+	}
+	if d := remembered.EndsAt.Sub(remembered.CreatedAt); d != cfg.RememberLifetime {
+		t.Errorf("remember lifetime %v, want %v", d, cfg.RememberLifetime)
+	}
+	if got := cfg.expiry(remembered, now); !got.Equal(remembered.EndsAt) {
+		t.Errorf("remember expiry = %v, want %v", got, remembered.EndsAt)
+	}
+}
+
+func TestGraceExpiry(t *testing.T) {
+	soon := time.Now().Add(time.Second)
+	if got := graceExpiry(&models.Session{ExpiresAt: soon}); !got.Equal(soon) {
+		t.Errorf("graceExpiry = %v, want the earlier session expiry %v", got, soon)
+	}
+
+	later := time.Now().Add(time.Hour)
+	got := graceExpiry(&models.Session{ExpiresAt: later})
+	if got.After(time.Now().Add(sessionRotationGrace)) || !got.Before(later) {
+		t.Errorf("graceExpiry = %v, want within %v", got, sessionRotationGrace)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"real-time-forum/models"
+)
+
+// SessionsHandler lets users see and end their own sessions.
+//
+//	GET                   - list sessions, most recently active first
+//	DELETE ?id=<handle>   - revoke one session
+//	DELETE ?others=true   - revoke every session except the current one
+//
+// Revoked sessions also lose their WebSocket connections.
+func SessionsHandler(sessions SessionStore, hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := GetSession(sessions, r)
+		if session == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			handleListSessions(sessions, w, session)
+		case http.MethodDelete:
+			handleRevokeSessions(sessions, hub, w, r, session)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// sessionHandle derives the public handle of a session. Session IDs are
+// bearer credentials, so they are never sent to the page.
+func sessionHandle(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// currentSessionID returns the ID the caller's session is stored under. A
+// request made with a rotated-out ID belongs to its replacement.
+func currentSessionID(current *models.Session) string {
+	if current.ReplacedBy != "" {
+		return current.ReplacedBy
+	}
+	return current.ID
+}
+
+// handleListSessions returns the caller's live sessions
+func handleListSessions(sessions SessionStore, w http.ResponseWriter, current *models.Session) {
+	list, err := sessions.ListForUser(current.UserID)
+	if err != nil {
+		log.Printf("Session list error: %v", err)
+		http.Error(w, "Failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+
+	active := make([]models.ActiveSession, 0, len(list))
+	for _, sess := range list {
+		active = append(active, models.ActiveSession{
+			ID:         sessionHandle(sess.ID),
+			UserAgent:  sess.UserAgent,
+			IP:         sess.IP,
+			CreatedAt:  sess.CreatedAt,
+			LastActive: sess.LastActive,
+			Current:    sess.ID == currentSessionID(current),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(active)
+}
+
+// handleRevokeSessions ends one session by handle, or all but the current one
+func handleRevokeSessions(sessions SessionStore, hub *Hub, w http.ResponseWriter, r *http.Request, current *models.Session) {
+	handle := r.URL.Query().Get("id")
+	others := r.URL.Query().Get("others") == "true"
+	if handle == "" && !others {
+		http.Error(w, "Session ID or others=true is required", http.StatusBadRequest)
+		return
+	}
+
+	list, err := sessions.ListForUser(current.UserID)
+	if err != nil {
+		log.Printf("Session list error: %v", err)
+		http.Error(w, "Failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+
+	found := false
+	for _, sess := range list {
+		if others && sess.ID == currentSessionID(current) {
+			continue
+		}
+		if !others && sessionHandle(sess.ID) != handle {
+			continue
+		}
+		found = true
+
+		if err := sessions.Delete(sess.ID); err != nil {
+			log.Printf("Session delete error: %v", err)
+			http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+			return
+		}
+		hub.CloseSession(sess.ID)
+	}
+
+	if !others && !found {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	// Revoking the current session is a logout
+	if !others && sessionHandle(currentSessionID(current)) == handle {
+		ClearSession(sessions, w, r)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"real-time-forum/models"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultCommentPageSize = 20 // top-level comments, or replies when paging one parent
+	maxCommentPageSize     = 100
+	replyPreviewSize       = 3 // replies shown inline under each comment
+	maxCommentDepth        = 4 // reply levels returned in one response
+)
+
+// commentSorts are the orders siblings in a comment thread can be listed in.
+// They work like postSorts.
+var commentSorts = map[string]postSort{
+	"oldest": {keys: []string{"created_key", "id"}, desc: false},
+	"newest": {keys: []string{"created_key", "id"}, desc: true},
+	"top":    {keys: []string{"score", "created_key", "id"}, desc: true},
+}
+
+// commentListQuery selects comments on a post with the computed columns the
+// sorts use. The caller fills in which parent(s) to list.
+const commentListQuery = `
+	SELECT * FROM (
+		SELECT c.id, c.post_id, COALESCE(c.parent_comment_id, '') AS parent_id, c.user_id, c.nickname,
+			c.content, c.likes, c.dislikes, COALESCE(r.reaction, '') AS user_reaction,
+			c.edited_at IS NOT NULL AS edited, c.deleted_at IS NOT NULL AS deleted, c.created_at,
+			CAST(c.created_at AS TEXT) AS created_key,
+			c.likes - c.dislikes AS score,
+			(SELECT COUNT(*) FROM comments rc
+				WHERE rc.post_id = c.post_id AND rc.parent_comment_id = c.id) AS reply_count
+		FROM comments c
+		LEFT JOIN reactions r
+			ON r.target_type = 'comment' AND r.target_id = c.id AND r.user_id = ?
+		WHERE c.post_id = ? AND %s
+	)`
+
+var (
+	errInvalidSort   = errors.New("invalid sort")
+	errInvalidLimit  = errors.New("invalid limit")
+	errInvalidCursor = errors.New("invalid cursor")
+)
+
+// commentPage describes which slice of a comment thread to load
+type commentPage struct {
+	sortName string
+	order    postSort
+	limit    int
+	after    []interface{}
+}
+
+// parseCommentPage reads the sort, limit and cursor query parameters
+func parseCommentPage(query url.Values) (*commentPage, error) {
+	page := &commentPage{sortName: query.Get("sort"), limit: defaultCommentPageSize}
+	if page.sortName == "" {
+		page.sortName = "oldest"
+	}
+	order, ok := commentSorts[page.sortName]
+	if !ok {
+		return nil, errInvalidSort
+	}
+	page.order = order
+
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			return nil, errInvalidLimit
+		}
+		page.limit = min(n, maxCommentPageSize)
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		keys, ok := decodeKeyCursor(cursor, page.sortName, len(order.keys))
+		if !ok {
+			return nil, errInvalidCursor
+		}
+		page.after = keys
+	}
+	return page, nil
+}
+
+// scannedComment is a comment row with its sort keys
+type scannedComment struct {
+	comment    models.Comment
+	createdKey string
+	score      int
+}
+
+// sortKeys returns the values of order's key columns for the row
+func (sc scannedComment) sortKeys(order postSort) []interface{} {
+	keys := make([]interface{}, 0, len(order.keys))
+	for _, key := range order.keys {
+		switch key {
+		case "created_key":
+			keys = append(keys, sc.createdKey)
+		case "score":
+			keys = append(keys, sc.score)
+		case "id":
+			keys = append(keys, sc.comment.ID)
+		}
+	}
+	return keys
+}
+
+// queryComments runs commentListQuery and scans the rows. Deleted comments
+// come back as tombstones so their replies keep their place.
+func queryComments(db *sql.DB, query string, args ...interface{}) ([]scannedComment, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []scannedComment
+	for rows.Next() {
+		var sc scannedComment
+		c := &sc.comment
+		err := rows.Scan(&c.ID, &c.PostID, &c.ParentID, &c.UserID, &c.Nickname, &c.Content,
+			&c.LikeCount, &c.DislikeCount, &c.UserReaction, &c.Edited, &c.Deleted, &c.CreatedAt,
+			&sc.createdKey, &sc.score, &c.ReplyCount)
+		if err != nil {
+			return nil, err
+		}
+		if c.Deleted {
+			tombstoneComment(c)
+		}
+		result = append(result, sc)
+	}
+	return result, rows.Err()
+}
+
+// loadCommentPage returns one page of the comments under parentID (top level
+// when "") flattened depth-first, each followed by up to replyPreviewSize of
+// its own replies for maxCommentDepth levels. depth is the depth of the
+// page's comments. It also returns the cursor for the next page, or "".
+func loadCommentPage(db *sql.DB, postID, parentID, userID string, depth int, page *commentPage) ([]models.Comment, string, error) {
+	keyList := strings.Join(page.order.keys, ", ")
+	op, dir := ">", "ASC"
+	if page.order.desc {
+		op, dir = "<", "DESC"
+	}
+	orderBy := make([]string, len(page.order.keys))
+	for i, key := range page.order.keys {
+		orderBy[i] = key + " " + dir
+	}
+	orderList := strings.Join(orderBy, ", ")
+
+	// The page itself
+	args := []interface{}{userID, postID}
+	filter := "c.parent_comment_id IS NULL"
+	if parentID != "" {
+		filter = "c.parent_comment_id = ?"
+		args = append(args, parentID)
+	}
+	query := fmt.Sprintf(commentListQuery, filter)
+	if page.after != nil {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(page.after)), ", ")
+		query += " WHERE (" + keyList + ") " + op + " (" + placeholders + ")"
+		args = append(args, page.after...)
+	}
+	query += " ORDER BY " + orderList + " LIMIT ?"
+	args = append(args, page.limit+1)
+
+	roots, err := queryComments(db, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	nextCursor := ""
+	if len(roots) > page.limit {
+		roots = roots[:page.limit]
+		nextCursor = encodeKeyCursor(page.sortName, roots[len(roots)-1].sortKeys(page.order)...)
+	}
+
+	// Then a preview of replies, one query per level
+	children := make(map[string][]scannedComment)
+	level := roots
+	for l := 1; l < maxCommentDepth && len(level) > 0; l++ {
+		var ids []interface{}
+		for _, sc := range level {
+			if sc.comment.ReplyCount > 0 {
+				ids = append(ids, sc.comment.ID)
+			}
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+		inner := fmt.Sprintf(commentListQuery, "c.parent_comment_id IN ("+placeholders+")")
+		query := `
+			SELECT id, post_id, parent_id, user_id, nickname, content, likes, dislikes, user_reaction,
+				edited, deleted, created_at, created_key, score, reply_count
+			FROM (
+				SELECT *, ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY ` + orderList + `) AS position
+				FROM (` + inner + `)
+			)
+			WHERE position <= ?
+			ORDER BY parent_id, position`
+		args := append([]interface{}{userID, postID}, ids...)
+		args = append(args, replyPreviewSize)
+
+		level, err = queryComments(db, query, args...)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, sc := range level {
+			children[sc.comment.ParentID] = append(children[sc.comment.ParentID], sc)
+		}
+	}
+
+	comments := []models.Comment{}
+	var appendThread func(sc scannedComment, depth int)
+	appendThread = func(sc scannedComment, depth int) {
+		c := sc.comment
+		c.Depth = depth
+		replies := children[c.ID]
+		// Replies left out here are fetched with GET /api/comments?parent_id=
+		if c.ReplyCount > len(replies) {
+			c.HasMoreReplies = true
+			if len(replies) > 0 {
+				c.RepliesCursor = encodeKeyCursor(page.sortName, replies[len(replies)-1].sortKeys(page.order)...)
+			}
+		}
+		comments = append(comments, c)
+		for _, reply := range replies {
+			appendThread(reply, depth+1)
+		}
+	}
+	for _, sc := range roots {
+		appendThread(sc, depth)
+	}
+	return comments, nextCursor, nil
+}
+
+// handleListComments returns a page of a post's comments as a flattened
+// tree. Query parameters:
+//
+//	post_id   - the post
+//	parent_id - list replies to this comment instead of top-level comments
+//	sort      - oldest (default), newest or top
+//	limit     - page size, up to maxCommentPageSize
+//	cursor    - next_cursor from the previous page, or a comment's replies_cursor
+func handleListComments(db *sql.DB, w http.ResponseWriter, r *http.Request, session *models.Session) {
+	query := r.URL.Query()
+	postID := query.Get("post_id")
+	if postID == "" {
+		http.Error(w, "Post ID is required", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parseCommentPage(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var exists int
+	err = db.QueryRow(`SELECT COUNT(*) FROM posts WHERE id = ?`, postID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Failed to fetch post", http.StatusInternalServerError)
+		return
+	}
+	if exists == 0 {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	parentID := query.Get("parent_id")
+	depth := 0
+	if parentID != "" {
+		err = db.QueryRow(`
+			WITH RECURSIVE ancestors(id, parent_id) AS (
+				SELECT id, parent_comment_id FROM comments WHERE id = ? AND post_id = ?
+				UNION ALL
+				SELECT c.id, c.parent_comment_id FROM comments c JOIN ancestors a ON c.id = a.parent_id
+			)
+			SELECT COUNT(*) FROM ancestors`,
+			parentID, postID,
+		).Scan(&depth)
+		if err != nil {
+			http.Error(w, "Failed to fetch comment", http.StatusInternalServerError)
+			return
+		}
+		if depth == 0 {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	comments, nextCursor, err := loadCommentPage(db, postID, parentID, session.UserID, depth, page)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comments":    comments,
+		"next_cursor": nextCursor,
+	})
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// throttle allows at most one call per key within a fixed interval
+type throttle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     map[string]time.Time
+}
+
+func newThrottle(interval time.Duration) *throttle {
+	return &throttle{
+		interval: interval,
+		last:     make(map[string]time.Time),
+	}
+}
+
+// Allow reports whether key may proceed now, recording the attempt if so
+func (t *throttle) Allow(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if prev, ok := t.last[key]; ok && now.Sub(prev) < t.interval {
+		return false
+	}
+	t.last[key] = now
+
+	// Forget idle keys so the map doesn't grow with every user ever seen
+	if len(t.last) > 1024 {
+		for k, at := range t.last {
+			if now.Sub(at) >= t.interval {
+				delete(t.last, k)
+			}
+		}
+	}
+	return true
+}
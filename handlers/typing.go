@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// How long a typing indicator lasts without a stop or a fresh start
+const typingTimeout = 5 * time.Second
+
+// typingTracker expires typing indicators that never receive a stop event
+type typingTracker struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+type typingEvent struct {
+	ConversationID string `json:"conversation_id"`
+}
+
+type typingNotice struct {
+	ConversationID string `json:"conversation_id"`
+	UserID         string `json:"user_id"`
+	Nickname       string `json:"nickname"`
+}
+
+// RegisterTypingEvents wires typing.start and typing.stop client events into
+// the hub. Both are relayed only to the other participant of the conversation.
+func RegisterTypingEvents(db *sql.DB, hub *Hub) {
+	tracker := &typingTracker{timers: make(map[string]*time.Timer)}
+
+	hub.On("typing.start", func(c *Client, data json.RawMessage) {
+		notice, peerID, ok := resolveTyping(db, c, data)
+		if !ok {
+			return
+		}
+
+		key := notice.ConversationID + "|" + notice.UserID
+		if tracker.start(key, func() {
+			hub.SendToUser(peerID, "typing.stopped", notice)
+		}) {
+			hub.SendToUser(peerID, "typing.started", notice)
+		}
+	})
+
+	hub.On("typing.stop", func(c *Client, data json.RawMessage) {
+		notice, peerID, ok := resolveTyping(db, c, data)
+		if !ok {
+			return
+		}
+
+		if tracker.stop(notice.ConversationID + "|" + notice.UserID) {
+			hub.SendToUser(peerID, "typing.stopped", notice)
+		}
+	})
+}
+
+// resolveTyping decodes a typing event and checks the sender is a participant
+func resolveTyping(db *sql.DB, c *Client, data json.RawMessage) (typingNotice, string, bool) {
+	var ev typingEvent
+	if err := json.Unmarshal(data, &ev); err != nil || ev.ConversationID == "" {
+		c.Send("error", map[string]string{"error": "conversation_id is required"})
+		return typingNotice{}, "", false
+	}
+
+	peerID, err := conversationPeer(db, ev.ConversationID, c.UserID)
+	if err == sql.ErrNoRows {
+		c.Send("error", map[string]string{"error": "Conversation not found"})
+		return typingNotice{}, "", false
+	} else if err != nil {
+		log.Printf("Database error: %v", err)
+		return typingNotice{}, "", false
+	}
+
+	return typingNotice{
+		ConversationID: ev.ConversationID,
+		UserID:         c.UserID,
+		Nickname:       c.Nickname,
+	}, peerID, true
+}
+
+// start (re)arms the expiry timer for key, reporting whether typing just
+// began and should be announced
+func (t *typingTracker) start(key string, expire func()) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if timer, ok := t.timers[key]; ok {
+		if timer.Reset(typingTimeout) {
+			return false
+		}
+		// The timer already fired and its callback is waiting for the lock.
+		// Replacing the timer below makes that callback stand down, and
+		// typing is announced again in case the peer saw it stop.
+		timer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(typingTimeout, func() {
+		t.mu.Lock()
+		// A stop or restart may have replaced this timer in the meantime
+		current := t.timers[key] == timer
+		if current {
+			delete(t.timers, key)
+		}
+		t.mu.Unlock()
+
+		if current {
+			expire()
+		}
+	})
+	t.timers[key] = timer
+	return true
+}
+
+// stop clears the indicator for key, reporting whether one was active
+func (t *typingTracker) stop(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timer, ok := t.timers[key]
+	if !ok {
+		return false
+	}
+	timer.Stop()
+	delete(t.timers, key)
+	return true
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// WebSocketHandler upgrades an authenticated request and attaches it to the hub
+func WebSocketHandler(sessions SessionStore, hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := GetSession(sessions, r)
+		if session == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade has already written an HTTP error response
+			log.Printf("WebSocket upgrade error: %v", err)
+			return
+		}
+
+		client := &Client{
+			hub:       hub,
+			conn:      conn,
+			send:      make(chan []byte, sendBufferSize),
+			sessions:  sessions,
+			SessionID: currentSessionID(session),
+			UserID:    session.UserID,
+			Nickname:  session.Nickname,
+		}
+		hub.register(client)
+
+		go client.writePump()
+		client.readPump()
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"log"
 	"real-time-forum/db"
@@ -19,13 +25,28 @@ func LoggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r)
 	}
 }
-func ActivityMiddleware(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+func ActivityMiddleware(sessions handlers.SessionStore, hub *handlers.Hub, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		handlers.UpdateLastActive(db, w, r)
+		handlers.UpdateLastActive(sessions, hub, w, r)
 		next(w, r)
 	}
 }
 
+// durationFromEnv reads a duration such as "15m" from the environment,
+// falling back to def when the variable is unset or invalid
+func durationFromEnv(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Printf("Invalid %s %q, using %s", name, value, def)
+		return def
+	}
+	return d
+}
+
 
 
 
@@ -41,33 +62,97 @@ func main() {
 
 	db.InitializeSchema(dbConn)
 
+	// Users who may manage categories, e.g. ADMIN_NICKNAMES=alice,bob
+	db.GrantAdmin(dbConn, strings.Split(os.Getenv("ADMIN_NICKNAMES"), ","))
+
+	// How long authors may edit their comments (0 disables the limit)
+	commentEditWindow := durationFromEnv("COMMENT_EDIT_WINDOW", 15*time.Minute)
+
+	// Login sessions, shared by every handler that needs the current user
+	defaults := handlers.DefaultSessionConfig
+	sessions := handlers.NewSQLiteSessionStore(dbConn, handlers.SessionConfig{
+		IdleTimeout:      durationFromEnv("SESSION_IDLE_TIMEOUT", defaults.IdleTimeout),
+		Lifetime:         durationFromEnv("SESSION_LIFETIME", defaults.Lifetime),
+		RememberLifetime: durationFromEnv("SESSION_REMEMBER_LIFETIME", defaults.RememberLifetime),
+		RotateInterval:   durationFromEnv("SESSION_ROTATE_INTERVAL", defaults.RotateInterval),
+	})
+
+	// Real-time hub shared by the WebSocket endpoint and API handlers
+	hub := handlers.NewHub()
+	handlers.RegisterTypingEvents(dbConn, hub)
+	handlers.RegisterReadEvents(dbConn, hub)
+	handlers.RegisterFeedEvents(hub)
+
+	// Background cleanup of expired sessions and stale presence state
+	reaperDefaults := handlers.DefaultReaperConfig
+	reaper := handlers.NewReaper(sessions, hub, handlers.ReaperConfig{
+		SessionInterval:  durationFromEnv("REAPER_SESSION_INTERVAL", reaperDefaults.SessionInterval),
+		PresenceInterval: durationFromEnv("REAPER_PRESENCE_INTERVAL", reaperDefaults.PresenceInterval),
+		PresenceTTL:      durationFromEnv("PRESENCE_TTL", reaperDefaults.PresenceTTL),
+	})
+	reaper.Start()
+
 	// Static assets (index.html, JS, CSS)
 	fs := http.FileServer(http.Dir("./static"))
 	http.Handle("/", fs)
 
 	// Auth routes
 	http.HandleFunc("/signup", LoggingMiddleware(handlers.SignupHandler(dbConn)))
-	http.HandleFunc("/login", LoggingMiddleware(handlers.LoginHandler(dbConn)))
+	http.HandleFunc("/login", LoggingMiddleware(handlers.LoginHandler(dbConn, sessions)))
 
-	// post 
-	http.HandleFunc("/api/posts", LoggingMiddleware(ActivityMiddleware(dbConn, handlers.PostsHandler(dbConn))))
+	// Posts API
+	http.HandleFunc("/api/posts", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.PostsHandler(dbConn, sessions, hub))))
 
+	// Categories
+	http.HandleFunc("/api/categories", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.CategoriesHandler(dbConn, sessions))))
+	http.HandleFunc("/api/search", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.SearchHandler(dbConn, sessions))))
 
-	// Session management endpoints
-	http.HandleFunc("/api/check-auth", LoggingMiddleware(handlers.CheckAuthHandler(dbConn)))
-	http.HandleFunc("/api/logout", LoggingMiddleware(handlers.LogoutHandler(dbConn)))
-	// Add new endpoint
-	http.HandleFunc("/api/online-users", LoggingMiddleware(ActivityMiddleware(dbConn, handlers.OnlineUsersHandler(dbConn))))
+	// Likes and dislikes
+	http.HandleFunc("/api/reactions", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.ReactionsHandler(dbConn, sessions, hub))))
 
-	// Posts API
-http.HandleFunc("/api/posts", LoggingMiddleware(ActivityMiddleware(dbConn, handlers.PostsHandler(dbConn))))
+	// Post detail and comments
+	http.HandleFunc("/api/post", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.GetPostWithComments(dbConn, sessions))))
+	http.HandleFunc("/api/post/revisions", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.PostRevisionsHandler(dbConn, sessions))))
+	http.HandleFunc("/api/comments", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.CommentsHandler(dbConn, sessions, hub, commentEditWindow))))
 
-	// Online presence
-	http.HandleFunc("/api/online-users", LoggingMiddleware(ActivityMiddleware(dbConn, handlers.OnlineUsersHandler(dbConn))))
+	// Session management endpoints
+	http.HandleFunc("/api/check-auth", LoggingMiddleware(handlers.CheckAuthHandler(sessions)))
+	http.HandleFunc("/api/logout", LoggingMiddleware(handlers.LogoutHandler(sessions, hub)))
+	http.HandleFunc("/api/sessions", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.SessionsHandler(sessions, hub))))
 
-	// Run the server
+	// Online presence
+	http.HandleFunc("/api/online-users", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.OnlineUsersHandler(sessions, hub))))
+
+	// Private messages
+	http.HandleFunc("/api/chat-users", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.ChatUsersHandler(dbConn, sessions, hub))))
+	http.HandleFunc("/api/conversations", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.ConversationsHandler(dbConn, sessions))))
+	http.HandleFunc("/api/messages", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.MessagesHandler(dbConn, sessions, hub))))
+	http.HandleFunc("/api/messages/read", LoggingMiddleware(ActivityMiddleware(sessions, hub, handlers.MarkReadHandler(dbConn, sessions, hub))))
+
+	// WebSocket endpoint for real-time events
+	http.HandleFunc("/ws", LoggingMiddleware(handlers.WebSocketHandler(sessions, hub)))
+
+	// Run the server until interrupted, then let in-flight requests and
+	// cleanup jobs finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: ":8080", Handler: handlers.CSRFMiddleware(sessions, http.DefaultServeMux)}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
 	fmt.Println("Server running at http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown error: %v", err)
+	}
+	reaper.Stop()
 
 
 }
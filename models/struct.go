@@ -15,31 +15,161 @@ type User struct {
 	Gender       string
 	Email        string
 	PasswordHash string
+	IsAdmin      bool
 }
 
 
 type Post struct {
     ID           string    `json:"id"`
     UserID       string    `json:"user_id"`
-    CategoryID   string    `json:"category_id"`
+    Categories   []string  `json:"categories"`
     Title        string    `json:"title"`
     Content      string    `json:"content"`
     LikeCount    int       `json:"like_count"`
     DislikeCount int       `json:"dislike_count"`
+    CommentCount int       `json:"comment_count"`
+    UserReaction string    `json:"user_reaction,omitempty"`
+    Edited       bool      `json:"edited"`
+    Deleted      bool      `json:"deleted,omitempty"`
     CreatedAt    time.Time `json:"created_at"`
 }
 
+// PostRevision is the title and content a post had before an edit
+type PostRevision struct {
+	ID             string    `json:"id"`
+	PostID         string    `json:"post_id"`
+	Title          string    `json:"title"`
+	Content        string    `json:"content"`
+	EditorID       string    `json:"editor_id"`
+	EditorNickname string    `json:"editor_nickname"`
+	EditedAt       time.Time `json:"edited_at"`
+}
+
 
 type Comment struct {
-	ID        string    `json:"id"`
-	PostID    string    `json:"post_id"`
-	UserID    string    `json:"user_id"`
-	Body      string    `json:"body"`
-	CreatedAt time.Time `json:"created_at"`
+	ID           string    `json:"id"`
+	PostID       string    `json:"post_id"`
+	ParentID     string    `json:"parent_comment_id,omitempty"`
+	UserID       string    `json:"user_id"`
+	Nickname     string    `json:"nickname"`
+	Content      string    `json:"content"`
+	LikeCount    int       `json:"like_count"`
+	DislikeCount int       `json:"dislike_count"`
+	UserReaction string    `json:"user_reaction,omitempty"`
+	Edited       bool      `json:"edited"`
+	Deleted      bool      `json:"deleted,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// Position in a flattened comment tree
+	Depth          int    `json:"depth"`
+	ReplyCount     int    `json:"reply_count"`
+	HasMoreReplies bool   `json:"has_more_replies,omitempty"`
+	RepliesCursor  string `json:"replies_cursor,omitempty"`
+}
+
+// Category groups posts; archived categories stay readable but take no new posts
+type Category struct {
+	Slug        string    `json:"slug"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Position    int       `json:"position"`
+	Archived    bool      `json:"archived"`
+	PostCount   int       `json:"post_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Conversation is a one-to-one chat between two users, as seen by one of them
+type Conversation struct {
+	ID            string     `json:"id"`
+	OtherUserID   string     `json:"other_user_id"`
+	OtherNickname string     `json:"other_nickname"`
+	LastMessage   string     `json:"last_message,omitempty"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+}
+
+type Message struct {
+	ID             string    `json:"id"`
+	ConversationID string    `json:"conversation_id"`
+	SenderID       string    `json:"sender_id"`
+	SenderNickname string    `json:"sender_nickname"`
+	RecipientID    string    `json:"recipient_id"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+	Read           bool      `json:"read"`
+}
+
+// ReadReceipt reports how far a user has read a conversation
+type ReadReceipt struct {
+	ConversationID    string    `json:"conversation_id"`
+	ReaderID          string    `json:"reader_id"`
+	LastReadMessageID string    `json:"last_read_message_id"`
+	ReadAt            time.Time `json:"read_at"`
+}
+
+// OnlineUser is a presence entry for a connected user
+type OnlineUser struct {
+	UserID   string    `json:"user_id"`
+	Nickname string    `json:"nickname"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// ChatUser is an entry in the chat sidebar as seen by the current user
+type ChatUser struct {
+	UserID        string     `json:"user_id"`
+	Nickname      string     `json:"nickname"`
+	Online        bool       `json:"online"`
+	UnreadCount   int        `json:"unread_count"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+}
+
+// ReactionSummary is the state of a post or comment after a reaction changes
+type ReactionSummary struct {
+	TargetType   string `json:"target_type"`
+	TargetID     string `json:"target_id"`
+	PostID       string `json:"post_id"`
+	LikeCount    int    `json:"like_count"`
+	DislikeCount int    `json:"dislike_count"`
+	UserReaction string `json:"user_reaction"`
+}
+
+// SearchResult is one post or comment matching a search query. Snippet is
+// HTML-escaped with the matched terms wrapped in <mark>.
+type SearchResult struct {
+	Type       string    `json:"type"`
+	PostID     string    `json:"post_id"`
+	CommentID  string    `json:"comment_id,omitempty"`
+	Title      string    `json:"title"`
+	Snippet    string    `json:"snippet"`
+	Author     string    `json:"author"`
+	Categories []string  `json:"categories"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 type Session struct {
-	UserID    string
-	Nickname  string
-	ExpiresAt time.Time
+	ID          string
+	UserID      string
+	Nickname    string
+	IsAdmin     bool
+	CreatedAt   time.Time
+	LastActive  time.Time
+	ExpiresAt   time.Time
+	UserAgent   string
+	IP          string
+	Remember    bool      // long-lived "remember me" session
+	EndsAt      time.Time // absolute end; ExpiresAt never passes it
+	RotatedAt   time.Time // when the session last got a new ID
+	RoleChanged bool      // IsAdmin differs from when the ID was issued
+	ReplacedBy  string    // set on an old ID still in its rotation grace period
+	CSRFToken   string    // required on the session's state-changing requests
+}
+
+// ActiveSession is one of the current user's sessions as shown to them. ID
+// is a handle for revoking it, not the session ID itself.
+type ActiveSession struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastActive time.Time `json:"last_active"`
+	Current    bool      `json:"current"`
 }
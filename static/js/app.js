@@ -1,6 +1,9 @@
 // Fixed app.js with proper posts integration
 import { Router } from "./router.js";
 import { setupPostsPage, setupPostDetailsPage } from "./posts.js";
+import { setupSessionsPage } from "./sessions.js";
+import { csrfHeaders } from "./csrf.js";
+import { connectWebSocket, disconnectWebSocket, onEvent } from "./socket.js";
 
 document.addEventListener("DOMContentLoaded", () => {
   const router = new Router();
@@ -30,6 +33,24 @@ document.addEventListener("DOMContentLoaded", () => {
     });
   });
 
+  // Where the user is logged in
+  router.addRoute("sessions", "sessionsTemplate", () => {
+    isAuthenticated().then((auth) => {
+      if (!auth) {
+        router.navigateTo("login");
+      } else {
+        setupSessionsPage();
+      }
+    });
+  });
+
+  // The session was revoked from another device or expired
+  onEvent("session.revoked", () => {
+    disconnectWebSocket();
+    router.navigateTo("login");
+    updateNavigation(router);
+  });
+
   // Post details route (for individual posts)
   router.addRoute("post/:id", "postDetailsTemplate", (params) => {
     isAuthenticated().then((auth) => {
@@ -59,6 +80,7 @@ function isAuthenticated() {
 function logout() {
   return fetch("/api/logout", {
     method: "POST",
+    headers: csrfHeaders(),
     credentials: "include",
   });
 }
@@ -78,11 +100,17 @@ async function updateNavigation(router) {
     nav.innerHTML = `
       <a href="#posts" data-page="posts">Posts</a>
       <a href="#profile" data-page="profile">Profile</a>
+      <a href="#sessions" data-page="sessions">Sessions</a>
       <button id="logoutBtn">Logout</button>
     `;
 
+    connectWebSocket();
+
     // Add logout handler
     document.getElementById("logoutBtn").addEventListener("click", async () => {
+      // Disconnect first so the server closing the socket isn't taken
+      // for a revocation
+      disconnectWebSocket();
       await logout();
       router.navigateTo("/");
       updateNavigation(router);
@@ -125,6 +153,7 @@ function setupSignupForm(router) {
     try {
       const response = await fetch("/signup", {
         method: "POST",
+        headers: csrfHeaders(),
         body: formData,
       });
 
@@ -234,6 +263,9 @@ function setupLoginForm(router) {
       formData.append("nickname", nickname);
       formData.append("email", email);
       formData.append("password", password);
+      if (form.querySelector("#remember").checked) {
+        formData.append("remember", "true");
+      }
 
       console.log("Sending data to server:", formData.toString());
 
@@ -241,6 +273,7 @@ function setupLoginForm(router) {
         method: "POST",
         headers: {
           "Content-Type": "application/x-www-form-urlencoded",
+          ...csrfHeaders(),
         },
         body: formData.toString(),
       });
@@ -268,47 +301,6 @@ function setupLoginForm(router) {
   });
 }
 
-function setupOnlineUsers() {
-  function updateOnlineUsers() {
-    fetch("/api/online-users", { credentials: "include" })
-      .then((response) => {
-        if (response.ok) {
-          return response.json();
-        }
-        throw new Error("Failed to fetch online users");
-      })
-      .then((users) => {
-        const list = document.getElementById("onlineUsersList");
-        if (list) {
-          list.innerHTML = users
-            .map(
-              (user) =>
-                `<li class="online-user" data-nickname="${user}">${user}</li>`
-            )
-            .join("");
-        }
-      })
-      .catch((error) => {
-        console.error("Error updating online users:", error);
-      });
-  }
-
-  // Update online users immediately and then every 30 seconds
-  updateOnlineUsers();
-  const onlineUsersInterval = setInterval(updateOnlineUsers, 30000);
-
-  // Clean up interval when leaving the page
-  window.addEventListener(
-    "hashchange",
-    () => {
-      if (window.location.hash !== "#posts") {
-        clearInterval(onlineUsersInterval);
-      }
-    },
-    { once: true }
-  );
-}
-
 function showMessage(message, isError = true) {
   // Remove any existing message
   const existingMsg = document.querySelector(".message");
@@ -367,45 +359,42 @@ document.addEventListener("click", (e) => {
   }
 });
 
-// WebSocket for real-time updates
-function setupWebSocket() {
-  const socket = new WebSocket(`wss://${window.location.host}/ws`);
+// Keep the chat sidebar in sync with real-time events
+["open", "presence.online", "presence.offline", "message.created", "message.read"].forEach(
+  (type) => onEvent(type, updateChatUsers)
+);
 
-  socket.onmessage = (event) => {
-    if (event.data === "presence_update") {
-      // Update online users if we're on posts page
-      if (window.location.hash === "#posts") {
-        updateOnlineUsers();
+// Render the chat sidebar: recent conversations first, then everyone else
+function updateChatUsers() {
+  fetch("/api/chat-users", { credentials: "include" })
+    .then((response) => {
+      if (response.ok) {
+        return response.json();
       }
-    }
-  };
-
-  socket.onerror = (error) => {
-    console.error("WebSocket error:", error);
-  };
-
-  return socket;
-}
-
-// Set up WebSocket connection
-const socket = setupWebSocket();
-
-// Function to update online users (used by WebSocket)
-function updateOnlineUsers() {
-  fetch("/api/online-users", { credentials: "include" })
-    .then((response) => response.json())
+      throw new Error("Failed to fetch chat users");
+    })
     .then((users) => {
       const list = document.getElementById("onlineUsersList");
-      if (list) {
-        list.innerHTML = users
-          .map(
-            (user) =>
-              `<li class="online-user" data-nickname="${user}">${user}</li>`
-          )
-          .join("");
-      }
+      if (!list) return;
+
+      list.innerHTML = "";
+      users.forEach((user) => {
+        const item = document.createElement("li");
+        item.className = user.online ? "chat-user online" : "chat-user offline";
+        item.dataset.userId = user.user_id;
+        item.dataset.nickname = user.nickname;
+        item.textContent = user.nickname;
+
+        if (user.unread_count > 0) {
+          const badge = document.createElement("span");
+          badge.className = "unread-badge";
+          badge.textContent = user.unread_count;
+          item.appendChild(badge);
+        }
+        list.appendChild(item);
+      });
     })
     .catch((err) => {
-      console.error("Error fetching online users:", err);
+      console.error("Error fetching chat users:", err);
     });
 }
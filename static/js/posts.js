@@ -1,4 +1,9 @@
 // posts.js - Posts page functionality
+import { onEvent, sendEvent } from "./socket.js";
+import { csrfHeaders } from "./csrf.js";
+
+// Category currently shown in the feed
+let currentCategory = "all";
 
 // Escape HTML to prevent XSS
 function escapeHTML(str) {
@@ -31,41 +36,52 @@ function showPostsError(message) {
   }
 }
 
-// Fetch and display posts
-async function loadPosts(category = "") {
-  console.log("=== LOAD POSTS CALLED ===");
-  console.log("Loading posts for category:", category);
-  console.log("Current URL:", window.location.href);
+// Cursor for the next page of the current listing ("" when there is none)
+let nextPostsCursor = "";
 
-  const postsContainer = document.getElementById("posts-container");
-  console.log("Posts container found:", !!postsContainer);
+// Fetch and display posts; with more=true the next page is appended
+async function loadPosts(category = currentCategory, more = false) {
+  console.log("Loading posts for category:", category, "more:", more);
 
+  const postsContainer = document.getElementById("posts-container");
   if (!postsContainer) {
     console.error("Posts container not found! Cannot load posts.");
     return;
   }
 
-  showPostsLoading();
+  if (!more) {
+    showPostsLoading();
+  }
 
   try {
-    let url = "/api/posts";
+    const params = new URLSearchParams();
     if (category && category !== "all") {
-      url += `?category=${encodeURIComponent(category)}`;
+      params.set("category", category);
+    }
+    const sortSelect = document.getElementById("sort-select");
+    if (sortSelect) {
+      params.set("sort", sortSelect.value);
+    }
+    if (more && nextPostsCursor) {
+      params.set("cursor", nextPostsCursor);
     }
 
-    console.log("Fetching from URL:", url);
-
-    const response = await fetch(url, {
+    const response = await fetch(`/api/posts?${params.toString()}`, {
       credentials: "include",
     });
 
-    console.log("Posts response status:", response.status);
-    console.log("Posts response headers:", response.headers);
-
     if (response.ok) {
-      const posts = await response.json();
-      console.log("Received posts:", posts);
-      renderPosts(posts);
+      const data = await response.json();
+      nextPostsCursor = data.next_cursor;
+      if (more) {
+        postsContainer.insertAdjacentHTML(
+          "beforeend",
+          data.posts.map(renderPostItem).join("")
+        );
+      } else {
+        renderPosts(data.posts);
+      }
+      updateLoadMoreButton();
     } else if (response.status === 401) {
       console.log("Unauthorized - redirecting to login");
       showPostsError("You need to be logged in to view posts.");
@@ -81,6 +97,14 @@ async function loadPosts(category = "") {
   }
 }
 
+// Show the "Load more" button only while there are more pages
+function updateLoadMoreButton() {
+  const button = document.getElementById("load-more-posts");
+  if (button) {
+    button.style.display = nextPostsCursor ? "block" : "none";
+  }
+}
+
 // Render posts in the container
 function renderPosts(posts) {
   const postsContainer = document.getElementById("posts-container");
@@ -96,18 +120,33 @@ function renderPosts(posts) {
     return;
   }
 
-  postsContainer.innerHTML = posts
+  postsContainer.innerHTML = posts.map(renderPostItem).join("");
+}
+
+// Render a post's category badges
+function renderCategoryTags(categories) {
+  return (categories || [])
     .map(
-      (post) => `
-    <div class="post-item" style="border: 1px solid #ddd; padding: 15px; margin: 10px 0; border-radius: 5px; cursor: pointer;" 
+      (category) =>
+        `<span class="post-category" style="background: #e9ecef; padding: 2px 6px; border-radius: 3px; margin-right: 10px;">${escapeHTML(
+          category
+        )}</span>`
+    )
+    .join("");
+}
+
+// Render a single post summary
+function renderPostItem(post) {
+  return `
+    <div class="post-item" data-post-id="${post.id}" style="border: 1px solid #ddd; padding: 15px; margin: 10px 0; border-radius: 5px; cursor: pointer;" 
          onclick="viewPost('${post.id}')">
       <h3 style="margin: 0 0 10px 0;">${escapeHTML(post.title)}</h3>
       <div class="post-meta" style="margin-bottom: 10px;">
-        <span class="post-category" style="background: #e9ecef; padding: 2px 6px; border-radius: 3px; margin-right: 10px;">
-          ${escapeHTML(post.category_id)}
-        </span>
+        ${renderCategoryTags(post.categories)}
         <span class="post-stats">
-          👍 ${post.likes || 0} 👎 ${post.dislikes || 0}
+          👍 ${post.like_count || 0} 👎 ${post.dislike_count || 0} 💬 ${
+    post.comment_count || 0
+  }
         </span>
       </div>
       <div class="post-preview" style="color: #666; line-height: 1.4;">
@@ -116,19 +155,18 @@ function renderPosts(posts) {
       }
       </div>
       <div class="post-footer" style="color: #999; font-size: 0.8em; margin-top: 10px;">
-        Posted: ${new Date(post.created_at).toLocaleString()}
+        Posted: ${new Date(post.created_at).toLocaleString()}${post.edited ? " (edited)" : ""}
       </div>
     </div>
-  `
-    )
-    .join("");
+  `;
 }
 
-// Navigate to post details
+// Navigate to post details (global for the inline onclick handlers)
 function viewPost(postId) {
   console.log("Viewing post:", postId);
   window.location.hash = `post/${postId}`;
 }
+window.viewPost = viewPost;
 
 // Create a new post
 async function createPost() {
@@ -145,7 +183,9 @@ async function createPost() {
 
   const title = titleInput.value.trim();
   const content = contentInput.value.trim();
-  const category = categorySelect.value;
+  const categories = Array.from(categorySelect.selectedOptions).map(
+    (option) => option.value
+  );
 
   if (!title || !content) {
     alert("Please fill in both title and content.");
@@ -158,18 +198,19 @@ async function createPost() {
   }
 
   try {
-    console.log("Creating post:", { title, content, category });
+    console.log("Creating post:", { title, content, categories });
 
     const response = await fetch("/api/posts", {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
+        ...csrfHeaders(),
       },
       credentials: "include",
       body: JSON.stringify({
         title: title,
         content: content,
-        category_id: category,
+        categories: categories,
       }),
     });
 
@@ -182,7 +223,9 @@ async function createPost() {
       // Clear form
       titleInput.value = "";
       contentInput.value = "";
-      categorySelect.value = "general";
+      Array.from(categorySelect.options).forEach((option) => {
+        option.selected = false;
+      });
 
       // Reload posts to show the new one
       await loadPosts();
@@ -219,6 +262,43 @@ function showSuccessMessage(message) {
   }
 }
 
+// Fill the sidebar and the post form from /api/categories
+async function loadCategories() {
+  try {
+    const response = await fetch("/api/categories", { credentials: "include" });
+    if (!response.ok) return;
+    const categories = await response.json();
+
+    const categoryList = document.getElementById("category-list");
+    if (categoryList) {
+      categoryList.innerHTML =
+        `<li class="active" data-category="all">All Posts</li>` +
+        categories
+          .map(
+            (c) =>
+              `<li data-category="${escapeHTML(c.slug)}">${escapeHTML(
+                c.name
+              )} (${c.post_count})</li>`
+          )
+          .join("");
+    }
+
+    const categorySelect = document.getElementById("category-select");
+    if (categorySelect) {
+      categorySelect.innerHTML = categories
+        .map(
+          (c) =>
+            `<option value="${escapeHTML(c.slug)}">${escapeHTML(
+              c.name
+            )}</option>`
+        )
+        .join("");
+    }
+  } catch (err) {
+    console.error("Error loading categories:", err);
+  }
+}
+
 // Set up category filtering
 function setupCategoryFiltering() {
   const categoryList = document.getElementById("category-list");
@@ -241,15 +321,21 @@ function setupCategoryFiltering() {
       const selectedCategory = e.target.getAttribute("data-category");
       console.log("Category selected:", selectedCategory);
 
+      // Only receive live posts for the selected category
+      currentCategory = selectedCategory || "all";
+      sendEvent("feed.subscribe", {
+        categories: currentCategory === "all" ? [] : [currentCategory],
+      });
+
       // Load posts for selected category
       loadPosts(selectedCategory);
     }
   });
 }
 
-// Set up online users functionality
-function updateOnlineUsers() {
-  fetch("/api/online-users", { credentials: "include" })
+// Load the chat sidebar; later changes arrive over the WebSocket
+function updateChatUsers() {
+  fetch("/api/chat-users", { credentials: "include" })
     .then((response) => response.json())
     .then((users) => {
       const list = document.getElementById("onlineUsersList");
@@ -257,16 +343,46 @@ function updateOnlineUsers() {
         list.innerHTML = users
           .map(
             (user) =>
-              `<li class="online-user" data-nickname="${user}">${user}</li>`
+              `<li class="chat-user ${
+                user.online ? "online" : "offline"
+              }" data-user-id="${escapeHTML(
+                user.user_id
+              )}" data-nickname="${escapeHTML(user.nickname)}">${escapeHTML(
+                user.nickname
+              )}${
+                user.unread_count > 0
+                  ? `<span class="unread-badge">${user.unread_count}</span>`
+                  : ""
+              }</li>`
           )
           .join("");
       }
     })
     .catch((err) => {
-      console.error("Error fetching online users:", err);
+      console.error("Error fetching chat users:", err);
     });
 }
 
+// Show posts created by other users as they arrive
+function prependPost(post) {
+  const postsContainer = document.getElementById("posts-container");
+  if (!postsContainer || document.querySelector(`[data-post-id="${post.id}"]`)) {
+    return;
+  }
+  if (!postsContainer.querySelector(".post-item")) {
+    postsContainer.innerHTML = "";
+  }
+  postsContainer.insertAdjacentHTML("afterbegin", renderPostItem(post));
+}
+
+onEvent("post.created", prependPost);
+
+// Drop deleted posts from the list
+onEvent("post.deleted", ({ post_id }) => {
+  const item = document.querySelector(`.post-item[data-post-id="${post_id}"]`);
+  if (item) item.remove();
+});
+
 // Main setup function for posts page
 export function setupPostsPage() {
   console.log("Setting up posts page");
@@ -298,14 +414,26 @@ export function setupPostsPage() {
       console.log("Post submit button listener added");
 
       // Set up category filtering
+      loadCategories();
       setupCategoryFiltering();
 
-      // Set up online users updates
-      updateOnlineUsers();
-      setInterval(updateOnlineUsers, 30000);
+      // Show the chat sidebar
+      updateChatUsers();
+
+      // Sorting and paging
+      const sortSelect = document.getElementById("sort-select");
+      if (sortSelect) {
+        sortSelect.addEventListener("change", () => loadPosts());
+      }
+      const loadMoreBtn = document.getElementById("load-more-posts");
+      if (loadMoreBtn) {
+        loadMoreBtn.addEventListener("click", () => loadPosts(currentCategory, true));
+      }
 
       // Load initial posts - this is the important part!
       console.log("Loading initial posts");
+      currentCategory = "all";
+      sendEvent("feed.subscribe", { categories: [] });
       loadPosts();
     }
   }, 50);
@@ -317,12 +445,564 @@ export function setupPostsPage() {
   }, 5000);
 }
 
-// Export function for post details (if needed by other files)
+// Render the open post
+function renderPostDetails(post) {
+  const container = document.getElementById("post-details");
+  if (!container) return;
+
+  container.innerHTML = `
+    <h2>${escapeHTML(post.title)}</h2>
+    <div class="post-meta">
+      ${renderCategoryTags(post.categories)}
+      <span class="post-stats">
+        <button class="reaction-btn like-btn ${
+          post.user_reaction === "like" ? "active" : ""
+        }" data-reaction="like">👍 <span class="like-count">${
+    post.like_count || 0
+  }</span></button>
+        <button class="reaction-btn dislike-btn ${
+          post.user_reaction === "dislike" ? "active" : ""
+        }" data-reaction="dislike">👎 <span class="dislike-count">${
+    post.dislike_count || 0
+  }</span></button>
+      </span>
+    </div>
+    <div class="post-content">${escapeHTML(post.content)}</div>
+    <div class="post-footer">Posted: ${new Date(
+      post.created_at
+    ).toLocaleString()}${post.edited ? " (edited)" : ""}</div>
+  `;
+
+  container.querySelectorAll(".reaction-btn").forEach((btn) => {
+    btn.addEventListener("click", () =>
+      react("post", post.id, btn.dataset.reaction, container)
+    );
+  });
+}
+
+// Like or dislike a post or comment and refresh its counters
+async function react(targetType, targetId, reaction, element) {
+  try {
+    const response = await fetch("/api/reactions", {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        ...csrfHeaders(),
+      },
+      credentials: "include",
+      body: JSON.stringify({
+        target_type: targetType,
+        target_id: targetId,
+        reaction: reaction,
+      }),
+    });
+
+    if (!response.ok) {
+      const errorText = await response.text();
+      alert(`Failed to react: ${errorText}`);
+      return;
+    }
+
+    updateReactionCounts(element, await response.json());
+  } catch (err) {
+    console.error("Error reacting:", err);
+  }
+}
+
+// Show new counters (and the user's own reaction when known)
+function updateReactionCounts(element, summary) {
+  if (!element) return;
+  const likeCount = element.querySelector(".like-count");
+  const dislikeCount = element.querySelector(".dislike-count");
+  if (likeCount) likeCount.textContent = summary.like_count;
+  if (dislikeCount) dislikeCount.textContent = summary.dislike_count;
+
+  if (summary.user_reaction !== undefined) {
+    element.querySelectorAll(".reaction-btn").forEach((btn) => {
+      btn.classList.toggle(
+        "active",
+        btn.dataset.reaction === summary.user_reaction
+      );
+    });
+  }
+}
+
+// Render a single comment
+function renderComment(comment) {
+  if (comment.deleted) {
+    return `
+    <div class="comment deleted" data-comment-id="${comment.id}" data-depth="${
+      comment.depth || 0
+    }" style="margin-left: ${(comment.depth || 0) * 24}px">
+      <div class="comment-body">[deleted]</div>
+    </div>
+  `;
+  }
+
+  const canModify =
+    currentUser &&
+    (currentUser.user_id === comment.user_id || currentUser.is_admin);
+
+  return `
+    <div class="comment" data-comment-id="${comment.id}" data-depth="${
+      comment.depth || 0
+    }" style="margin-left: ${(comment.depth || 0) * 24}px">
+      <div class="comment-body">${escapeHTML(comment.content)}</div>
+      <div class="comment-meta">${escapeHTML(comment.nickname)} · ${new Date(
+        comment.created_at
+      ).toLocaleString()}${comment.edited ? " (edited)" : ""}
+        <button class="reaction-btn ${
+          comment.user_reaction === "like" ? "active" : ""
+        }" data-reaction="like">👍 <span class="like-count">${
+    comment.like_count || 0
+  }</span></button>
+        <button class="reaction-btn ${
+          comment.user_reaction === "dislike" ? "active" : ""
+        }" data-reaction="dislike">👎 <span class="dislike-count">${
+    comment.dislike_count || 0
+  }</span></button>
+        <button class="comment-reply-btn">Reply</button>
+        ${
+          canModify
+            ? `<button class="comment-edit-btn">Edit</button>
+        <button class="comment-delete-btn">Delete</button>`
+            : ""
+        }
+      </div>
+    </div>
+  `;
+}
+
+// Swap a rendered comment for a new version of it
+function replaceComment(comment) {
+  const element = document.querySelector(`[data-comment-id="${comment.id}"]`);
+  if (element) {
+    comment.depth = Number(element.dataset.depth);
+    element.outerHTML = renderComment(comment);
+  }
+}
+
+// Button that fetches the next page of a comment's replies (or of the
+// top-level comments when parentId is empty)
+function renderMoreButton(parentId, depth, cursor) {
+  return `
+    <button class="load-more-comments" data-parent-id="${parentId}" data-depth="${depth}"
+      data-cursor="${cursor}" style="margin-left: ${depth * 24}px">
+      ${parentId ? "Show more replies" : "Load more comments"}
+    </button>
+  `;
+}
+
+// Render a flattened comment tree. A comment with replies left out gets a
+// "Show more replies" button after the replies that are shown.
+function renderCommentList(comments) {
+  let html = "";
+  const pending = [];
+  const flush = (depth) => {
+    while (pending.length && pending[pending.length - 1].depth >= depth) {
+      const parent = pending.pop();
+      html += renderMoreButton(
+        parent.id,
+        parent.depth + 1,
+        parent.replies_cursor || ""
+      );
+    }
+  };
+
+  comments.forEach((comment) => {
+    flush(comment.depth || 0);
+    html += renderComment(comment);
+    if (comment.has_more_replies) pending.push(comment);
+  });
+  flush(0);
+  return html;
+}
+
+// Replace a "load more" button with the page it stands for
+async function loadMoreComments(postId, button) {
+  const params = new URLSearchParams({ post_id: postId, sort: commentSort() });
+  if (button.dataset.parentId) params.set("parent_id", button.dataset.parentId);
+  if (button.dataset.cursor) params.set("cursor", button.dataset.cursor);
+
+  try {
+    const response = await fetch(`/api/comments?${params.toString()}`, {
+      credentials: "include",
+    });
+    if (!response.ok) {
+      const errorText = await response.text();
+      alert(`Failed to load comments: ${errorText}`);
+      return;
+    }
+
+    const data = await response.json();
+    let html = renderCommentList(data.comments);
+    if (data.next_cursor) {
+      html += renderMoreButton(
+        button.dataset.parentId,
+        Number(button.dataset.depth),
+        data.next_cursor
+      );
+    }
+    button.outerHTML = html;
+  } catch (err) {
+    console.error("Error loading comments:", err);
+  }
+}
+
+// Reply to a comment on the open post
+async function replyToComment(postId, parentId) {
+  const content = prompt("Write a reply");
+  if (content === null || !content.trim()) return;
+
+  try {
+    const response = await fetch("/api/comments", {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        ...csrfHeaders(),
+      },
+      credentials: "include",
+      body: JSON.stringify({
+        post_id: postId,
+        parent_comment_id: parentId,
+        content: content,
+      }),
+    });
+
+    if (response.ok) {
+      appendComment(await response.json());
+    } else {
+      const errorText = await response.text();
+      alert(`Failed to post reply: ${errorText}`);
+    }
+  } catch (err) {
+    console.error("Error posting reply:", err);
+  }
+}
+
+// Edit a comment's text in place
+async function editComment(commentId) {
+  const element = document.querySelector(`[data-comment-id="${commentId}"]`);
+  const body = element && element.querySelector(".comment-body");
+  const content = prompt("Edit comment", body ? body.textContent : "");
+  if (content === null || !content.trim()) return;
+
+  try {
+    const response = await fetch(
+      `/api/comments?id=${encodeURIComponent(commentId)}`,
+      {
+        method: "PUT",
+        headers: {
+          "Content-Type": "application/json",
+          ...csrfHeaders(),
+        },
+        credentials: "include",
+        body: JSON.stringify({ content: content }),
+      }
+    );
+
+    if (response.ok) {
+      replaceComment(await response.json());
+    } else {
+      const errorText = await response.text();
+      alert(`Failed to edit comment: ${errorText}`);
+    }
+  } catch (err) {
+    console.error("Error editing comment:", err);
+  }
+}
+
+// Delete a comment, leaving a tombstone in the thread
+async function deleteComment(commentId) {
+  if (!confirm("Delete this comment?")) return;
+
+  try {
+    const response = await fetch(
+      `/api/comments?id=${encodeURIComponent(commentId)}`,
+      {
+        method: "DELETE",
+        headers: csrfHeaders(),
+        credentials: "include",
+      }
+    );
+
+    if (response.ok) {
+      replaceComment({ id: commentId, deleted: true });
+    } else {
+      const errorText = await response.text();
+      alert(`Failed to delete comment: ${errorText}`);
+    }
+  } catch (err) {
+    console.error("Error deleting comment:", err);
+  }
+}
+
+function renderComments(comments, nextCursor) {
+  const container = document.getElementById("comments-container");
+  if (!container) return;
+
+  if (!comments || comments.length === 0) {
+    container.innerHTML =
+      '<p class="no-comments">No comments yet. Start the conversation!</p>';
+    return;
+  }
+  container.innerHTML =
+    renderCommentList(comments) +
+    (nextCursor ? renderMoreButton("", 0, nextCursor) : "");
+}
+
+// Add a new comment or reply in its place in the thread, unless it is
+// already shown or belongs to a part of the thread that isn't loaded yet
+function appendComment(comment) {
+  const container = document.getElementById("comments-container");
+  if (
+    !container ||
+    document.querySelector(`[data-comment-id="${comment.id}"]`)
+  ) {
+    return;
+  }
+
+  if (!comment.parent_comment_id) {
+    if (container.querySelector('.load-more-comments[data-parent-id=""]')) {
+      return;
+    }
+    const placeholder = container.querySelector(".no-comments");
+    if (placeholder) placeholder.remove();
+    container.insertAdjacentHTML(
+      commentSort() === "newest" ? "afterbegin" : "beforeend",
+      renderComment(comment)
+    );
+    return;
+  }
+
+  const parent = container.querySelector(
+    `[data-comment-id="${comment.parent_comment_id}"]`
+  );
+  if (!parent) return;
+
+  // Replies go after the last element of the parent's subtree
+  const parentDepth = Number(parent.dataset.depth);
+  let last = parent;
+  while (
+    last.nextElementSibling &&
+    Number(last.nextElementSibling.dataset.depth) > parentDepth
+  ) {
+    last = last.nextElementSibling;
+    if (
+      last.classList.contains("load-more-comments") &&
+      last.dataset.parentId === comment.parent_comment_id
+    ) {
+      return;
+    }
+  }
+  comment.depth = parentDepth + 1;
+  last.insertAdjacentHTML("afterend", renderComment(comment));
+}
+
+// Tell the user when someone replies to one of their comments
+function showReplyNotice(comment) {
+  if (comment.post_id === openPostId) return;
+
+  const notice = document.createElement("div");
+  notice.className = "reply-notice";
+  notice.textContent = `${comment.nickname} replied to your comment`;
+  notice.addEventListener("click", () => {
+    notice.remove();
+    viewPost(comment.post_id);
+  });
+  document.body.appendChild(notice);
+  setTimeout(() => notice.remove(), 8000);
+}
+
+onEvent("comment.reply", showReplyNotice);
+
+// Order chosen for the open post's comments
+function commentSort() {
+  const select = document.getElementById("comment-sort-select");
+  return select ? select.value : "oldest";
+}
+
+// Fetch a post with its comments
+async function loadPostDetails(postId) {
+  try {
+    const params = new URLSearchParams({ id: postId, sort: commentSort() });
+    const response = await fetch(`/api/post?${params.toString()}`, {
+      credentials: "include",
+    });
+
+    if (response.status === 401) {
+      window.location.hash = "login";
+      return;
+    }
+    if (!response.ok) {
+      const errorText = await response.text();
+      const container = document.getElementById("post-details");
+      if (container) {
+        container.innerHTML = `<div class="error">${escapeHTML(
+          errorText
+        )}</div>`;
+      }
+      return;
+    }
+
+    const data = await response.json();
+    renderPostDetails(data.post);
+    renderComments(data.comments, data.next_cursor);
+  } catch (err) {
+    console.error("Error loading post:", err);
+  }
+}
+
+// Submit a comment on the open post
+async function submitComment(postId) {
+  const textArea = document.getElementById("comment-text");
+  if (!textArea) return;
+
+  const content = textArea.value.trim();
+  if (!content) {
+    alert("Please write a comment first.");
+    return;
+  }
+
+  try {
+    const response = await fetch("/api/comments", {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        ...csrfHeaders(),
+      },
+      credentials: "include",
+      body: JSON.stringify({ post_id: postId, content: content }),
+    });
+
+    if (response.ok) {
+      const comment = await response.json();
+      textArea.value = "";
+      appendComment(comment);
+    } else {
+      const errorText = await response.text();
+      alert(`Failed to post comment: ${errorText}`);
+    }
+  } catch (err) {
+    console.error("Error posting comment:", err);
+    alert("An error occurred while posting the comment.");
+  }
+}
+
+// Post whose comments are currently streamed to this page
+let openPostId = null;
+
+// The signed-in user, used to decide which comments show Edit/Delete
+let currentUser = null;
+
+async function loadCurrentUser() {
+  try {
+    const response = await fetch("/api/check-auth", {
+      credentials: "include",
+    });
+    currentUser = response.ok ? await response.json() : null;
+  } catch (err) {
+    currentUser = null;
+  }
+}
+
+onEvent("comment.created", (comment) => {
+  if (comment.post_id === openPostId) {
+    appendComment(comment);
+  }
+});
+
+// The author edited the open post
+onEvent("post.updated", (post) => {
+  if (post.id !== openPostId) return;
+
+  const details = document.getElementById("post-details");
+  const liked = details && details.querySelector(".like-btn.active");
+  const disliked = details && details.querySelector(".dislike-btn.active");
+  post.user_reaction = liked ? "like" : disliked ? "dislike" : "";
+  renderPostDetails(post);
+});
+
+onEvent("comment.updated", (comment) => {
+  if (comment.post_id !== openPostId) return;
+
+  // Keep this viewer's own reaction, which isn't part of the broadcast
+  const element = document.querySelector(`[data-comment-id="${comment.id}"]`);
+  if (element) {
+    const liked = element.querySelector('[data-reaction="like"].active');
+    const disliked = element.querySelector('[data-reaction="dislike"].active');
+    comment.user_reaction = liked ? "like" : disliked ? "dislike" : "";
+  }
+  replaceComment(comment);
+});
+
+onEvent("comment.deleted", (comment) => {
+  if (comment.post_id === openPostId) {
+    replaceComment(comment);
+  }
+});
+
+// Counts changed by other viewers of the open post
+onEvent("reaction.updated", (summary) => {
+  if (summary.post_id !== openPostId) return;
+
+  const element =
+    summary.target_type === "post"
+      ? document.getElementById("post-details")
+      : document.querySelector(`[data-comment-id="${summary.target_id}"]`);
+  updateReactionCounts(element, summary);
+});
+
+// Set up the post details page
 export function setupPostDetailsPage(postId) {
-  // This would contain the post details functionality
-  // For now, just log that we're setting up post details
   console.log("Setting up post details page for:", postId);
 
-  // You can move the post-details.js content here if needed
-  // or keep it separate and import it
+  // Stream new comments while the post is open
+  openPostId = postId;
+  sendEvent("post.subscribe", { post_id: postId });
+  window.addEventListener(
+    "hashchange",
+    () => {
+      sendEvent("post.unsubscribe", { post_id: postId });
+      if (openPostId === postId) openPostId = null;
+    },
+    { once: true }
+  );
+
+  const submitBtn = document.getElementById("submit-comment");
+  if (submitBtn) {
+    submitBtn.addEventListener("click", () => submitComment(postId));
+  }
+
+  const sortSelect = document.getElementById("comment-sort-select");
+  if (sortSelect) {
+    sortSelect.addEventListener("change", () => loadPostDetails(postId));
+  }
+
+  const commentsContainer = document.getElementById("comments-container");
+  if (commentsContainer) {
+    commentsContainer.addEventListener("click", (e) => {
+      const more = e.target.closest(".load-more-comments");
+      if (more) {
+        loadMoreComments(postId, more);
+        return;
+      }
+
+      const comment = e.target.closest("[data-comment-id]");
+      if (!comment) return;
+
+      const btn = e.target.closest(".reaction-btn");
+      if (btn) {
+        react("comment", comment.dataset.commentId, btn.dataset.reaction, comment);
+      } else if (e.target.closest(".comment-reply-btn")) {
+        replyToComment(postId, comment.dataset.commentId);
+      } else if (e.target.closest(".comment-edit-btn")) {
+        editComment(comment.dataset.commentId);
+      } else if (e.target.closest(".comment-delete-btn")) {
+        deleteComment(comment.dataset.commentId);
+      }
+    });
+  }
+
+  loadCurrentUser().then(() => loadPostDetails(postId));
 }
@@ -13,9 +13,36 @@ export class Router {
         window.location.hash = `#${path}`;
     }
 
+    // Find the route for a path, filling in ":param" segments
+    matchRoute(path) {
+        if (this.routes[path]) {
+            return { route: this.routes[path], params: {} };
+        }
+
+        const parts = path.split("/");
+        for (const [pattern, route] of Object.entries(this.routes)) {
+            const patternParts = pattern.split("/");
+            if (patternParts.length !== parts.length) continue;
+
+            const params = {};
+            const matches = patternParts.every((part, i) => {
+                if (part.startsWith(":")) {
+                    params[part.substring(1)] = decodeURIComponent(parts[i]);
+                    return parts[i] !== "";
+                }
+                return part === parts[i];
+            });
+            if (matches) {
+                return { route, params };
+            }
+        }
+        return null;
+    }
+
     loadRoute() {
         let path = window.location.hash.substring(1) || "/";
-        const route = this.routes[path];
+        const match = this.matchRoute(path);
+        const route = match && match.route;
 
         if (route) {
             const template = document.getElementById(route.templateId);
@@ -24,7 +51,7 @@ export class Router {
                 this.main.appendChild(document.importNode(template.content, true));
 
                 if (route.callback) {
-                    route.callback();
+                    route.callback(match.params);
                 }
             } else {
                 console.warn(`Template not found for route: ${path}`);
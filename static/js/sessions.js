@@ -0,0 +1,91 @@
+// sessions.js - List the user's sessions and log out other devices
+import { csrfHeaders } from "./csrf.js";
+
+function escapeHTML(str) {
+  if (!str) return "";
+  return str.replace(/[&<>"']/g, function (match) {
+    const escapeMap = {
+      "&": "&amp;",
+      "<": "&lt;",
+      ">": "&gt;",
+      '"': "&quot;",
+      "'": "&#039;",
+    };
+    return escapeMap[match];
+  });
+}
+
+function renderSession(session) {
+  return `
+    <div class="session-item" data-session-id="${session.id}">
+      <div class="session-agent">${escapeHTML(session.user_agent || "Unknown device")}${
+    session.current ? " <strong>(this device)</strong>" : ""
+  }</div>
+      <div class="session-meta">
+        ${escapeHTML(session.ip)} · signed in ${new Date(
+    session.created_at
+  ).toLocaleString()} · last active ${new Date(
+    session.last_active
+  ).toLocaleString()}
+      </div>
+      ${session.current ? "" : '<button class="revoke-session-btn">Log out</button>'}
+    </div>
+  `;
+}
+
+async function loadSessions() {
+  const container = document.getElementById("sessions-container");
+  if (!container) return;
+
+  try {
+    const response = await fetch("/api/sessions", { credentials: "include" });
+    if (!response.ok) {
+      container.innerHTML = `<div class="error">${escapeHTML(
+        await response.text()
+      )}</div>`;
+      return;
+    }
+    const sessions = await response.json();
+    container.innerHTML = sessions.map(renderSession).join("");
+  } catch (err) {
+    console.error("Error loading sessions:", err);
+  }
+}
+
+// End one session, or every session but this one when id is empty
+async function revokeSessions(id) {
+  const query = id ? `id=${encodeURIComponent(id)}` : "others=true";
+  try {
+    const response = await fetch(`/api/sessions?${query}`, {
+      method: "DELETE",
+      headers: csrfHeaders(),
+      credentials: "include",
+    });
+    if (!response.ok) {
+      alert(`Failed to log out: ${await response.text()}`);
+    }
+  } catch (err) {
+    console.error("Error revoking session:", err);
+  }
+  loadSessions();
+}
+
+export function setupSessionsPage() {
+  const container = document.getElementById("sessions-container");
+  if (container) {
+    container.addEventListener("click", (e) => {
+      const item = e.target.closest(".revoke-session-btn") &&
+        e.target.closest("[data-session-id]");
+      if (item) {
+        revokeSessions(item.dataset.sessionId);
+      }
+    });
+  }
+
+  const revokeOthers = document.getElementById("revoke-other-sessions");
+  if (revokeOthers) {
+    revokeOthers.addEventListener("click", () => revokeSessions(""));
+  }
+
+  loadSessions();
+}
@@ -0,0 +1,150 @@
+// socket.js - Shared WebSocket connection and event dispatch
+let socket = null;
+const listeners = {};
+const pending = [];
+
+// Reconnect delays grow from 1s to 30s while the server stays unreachable
+const RECONNECT_BASE_DELAY = 1000;
+const RECONNECT_MAX_DELAY = 30000;
+let reconnectAttempts = 0;
+let reconnectTimer = null;
+
+// Subscriptions live on the connection, so they are remembered here and
+// sent again each time the socket opens instead of being queued
+let feedSubscription = null;
+const postSubscriptions = new Set();
+
+// Register a callback for a server event type (e.g. "post.created")
+export function onEvent(type, callback) {
+  if (!listeners[type]) {
+    listeners[type] = [];
+  }
+  listeners[type].push(callback);
+}
+
+// Send a typed event to the server, queueing it until the socket is open
+export function sendEvent(type, data) {
+  const open = socket && socket.readyState === WebSocket.OPEN;
+  if (rememberSubscription(type, data) && !open) {
+    return;
+  }
+
+  const message = JSON.stringify({ type, data });
+  if (open) {
+    socket.send(message);
+  } else {
+    pending.push(message);
+  }
+}
+
+// Track subscription events, reporting whether the event was one
+function rememberSubscription(type, data) {
+  switch (type) {
+    case "feed.subscribe":
+      feedSubscription = data;
+      return true;
+    case "post.subscribe":
+      postSubscriptions.add(data.post_id);
+      return true;
+    case "post.unsubscribe":
+      postSubscriptions.delete(data.post_id);
+      return true;
+    default:
+      return false;
+  }
+}
+
+function resubscribe() {
+  if (feedSubscription) {
+    socket.send(JSON.stringify({ type: "feed.subscribe", data: feedSubscription }));
+  }
+  postSubscriptions.forEach((postId) => {
+    socket.send(JSON.stringify({ type: "post.subscribe", data: { post_id: postId } }));
+  });
+}
+
+function dispatch(type, data) {
+  (listeners[type] || []).forEach((callback) => {
+    try {
+      callback(data);
+    } catch (err) {
+      console.error(`Error handling ${type} event:`, err);
+    }
+  });
+}
+
+function scheduleReconnect() {
+  const delay = Math.min(RECONNECT_BASE_DELAY * 2 ** reconnectAttempts, RECONNECT_MAX_DELAY);
+  reconnectAttempts++;
+  // Jitter keeps clients from reconnecting in lockstep after a restart
+  reconnectTimer = setTimeout(() => {
+    reconnectTimer = null;
+    connectWebSocket();
+  }, delay / 2 + Math.random() * (delay / 2));
+}
+
+// Open the WebSocket once the user is logged in
+export function connectWebSocket() {
+  if (socket && socket.readyState <= WebSocket.OPEN) {
+    return;
+  }
+  clearTimeout(reconnectTimer);
+  reconnectTimer = null;
+
+  const protocol = window.location.protocol === "https:" ? "wss" : "ws";
+  const ws = new WebSocket(`${protocol}://${window.location.host}/ws`);
+  socket = ws;
+
+  ws.onopen = () => {
+    reconnectAttempts = 0;
+    resubscribe();
+    while (pending.length > 0) {
+      ws.send(pending.shift());
+    }
+    dispatch("open");
+  };
+
+  ws.onmessage = (event) => {
+    let message;
+    try {
+      message = JSON.parse(event.data);
+    } catch (err) {
+      console.error("Invalid WebSocket message:", event.data);
+      return;
+    }
+    dispatch(message.type, message.data);
+  };
+
+  // The server closes with 1008 when this session was revoked or expired;
+  // any other close is retried
+  ws.onclose = (event) => {
+    if (socket !== ws) {
+      return;
+    }
+    socket = null;
+    if (event.code === 1008) {
+      dispatch("session.revoked");
+    } else {
+      scheduleReconnect();
+    }
+  };
+
+  ws.onerror = (error) => {
+    console.error("WebSocket error:", error);
+  };
+}
+
+// Close the WebSocket for good, e.g. on logout
+export function disconnectWebSocket() {
+  clearTimeout(reconnectTimer);
+  reconnectTimer = null;
+  reconnectAttempts = 0;
+  if (socket) {
+    const ws = socket;
+    socket = null;
+    ws.close();
+  }
+  pending.length = 0;
+  feedSubscription = null;
+  postSubscriptions.clear();
+}